@@ -0,0 +1,85 @@
+package kitten
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/chapin666/kitten/model"
+)
+
+// 指派的节点属性名称
+const (
+	AssignStrategyProperty   = "assign_strategy"   // 指派策略，默认为all
+	FallbackAssigneeProperty = "fallback_assignee" // 候选人为空时的备用处理人，多个以逗号分隔
+)
+
+// 定义指派策略
+const (
+	AssignStrategyAll         = "all"          // 所有候选人
+	AssignStrategyRoundRobin  = "round_robin"  // 轮流指派，选择在该节点上最久未被指派的候选人
+	AssignStrategyLeastLoaded = "least_loaded" // 选择待办数量最少的候选人
+	AssignStrategyRandom      = "random"       // 随机选择一个候选人
+	AssignStrategyFirst       = "first"        // 选择第一个候选人
+)
+
+// 节点是否设定了指派(指派人表达式、候选组、上级或部门)
+func hasAssignment(assigns []*model.NodeAssignment, props map[string]string) bool {
+	return len(assigns) > 0 ||
+		props[CandidateGroupsProperty] != "" ||
+		props[CandidateManagerOfProperty] != "" ||
+		props[CandidateDepartmentOfProperty] != ""
+}
+
+// 按节点的指派策略选择候选人
+// 设定了指派但候选人为空时使用备用处理人，未设定备用处理人时返回错误
+func (e *Engine) assignCandidates(
+	ctx context.Context,
+	nodeID string,
+	props map[string]string,
+	candidates []string,
+	assigned bool,
+) ([]string, error) {
+	if len(candidates) == 0 {
+		if fallback := splitProperty(props[FallbackAssigneeProperty]); len(fallback) > 0 {
+			return fallback, nil
+		} else if assigned {
+			return nil, fmt.Errorf("节点[%s]没有可指派的处理人", nodeID)
+		}
+		return nil, nil
+	}
+
+	switch strategy := props[AssignStrategyProperty]; strategy {
+	case "", AssignStrategyAll:
+		return candidates, nil
+	case AssignStrategyFirst:
+		return candidates[:1], nil
+	case AssignStrategyRandom:
+		return []string{candidates[rand.Intn(len(candidates))]}, nil
+	case AssignStrategyLeastLoaded:
+		counts, err := e.flowSvc.QueryCandidateTodoCounts(ctx, candidates)
+		if err != nil {
+			return nil, err
+		}
+		return []string{minCandidate(candidates, counts)}, nil
+	case AssignStrategyRoundRobin:
+		last, err := e.flowSvc.QueryCandidateLastAssigned(ctx, nodeID, candidates)
+		if err != nil {
+			return nil, err
+		}
+		return []string{minCandidate(candidates, last)}, nil
+	default:
+		return nil, fmt.Errorf("无效的指派策略[%s]", strategy)
+	}
+}
+
+// 选择统计值最小的候选人(没有统计值的候选人为0)，相同时选择靠前的候选人
+func minCandidate(candidates []string, stats map[string]int64) string {
+	result := candidates[0]
+	for _, c := range candidates[1:] {
+		if stats[c] < stats[result] {
+			result = c
+		}
+	}
+	return result
+}
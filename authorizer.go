@@ -0,0 +1,191 @@
+package kitten
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/chapin666/kitten/model"
+)
+
+// 可发起人的流程属性名称(部署时由BPMN的potentialStarter解析，多个以逗号分隔)
+const (
+	CandidateStarterUsersProperty  = "candidate_starter_users"  // 可发起流程的用户
+	CandidateStarterGroupsProperty = "candidate_starter_groups" // 可发起流程的用户组
+)
+
+// ErrForbidden 没有操作权限
+var ErrForbidden = errors.New("没有操作权限")
+
+// Action 引擎操作
+type Action string
+
+// 定义引擎操作
+const (
+	ActionDeploy   Action = "deploy"   // 部署流程
+	ActionStart    Action = "start"    // 发起流程
+	ActionHandle   Action = "handle"   // 处理节点(含签收、转办、委派、加签)
+	ActionStop     Action = "stop"     // 停止流程实例
+	ActionSuspend  Action = "suspend"  // 暂停或恢复流程实例
+	ActionUpdate   Action = "update"   // 修改流程实例(变量、流程事件)
+	ActionDelete   Action = "delete"   // 删除流程
+	ActionRead     Action = "read"     // 查询流程或实例数据
+	ActionDelegate Action = "delegate" // 创建或删除委托规则
+)
+
+// Resource 操作的资源，按操作提供相应的数据
+type Resource struct {
+	FlowCode     string              // 流程编号
+	Flow         *model.Flow         // 流程
+	FlowInstance *model.FlowInstance // 流程实例
+	NodeInstance *model.NodeInstance // 节点实例
+
+	DelegationRule *model.DelegationRule // 委托规则(创建或删除委托规则时提供)
+
+	CandidateStarterUsers  []string // 可发起流程的用户(发起流程时提供)
+	CandidateStarterGroups []string // 可发起流程的用户组(发起流程时提供)
+}
+
+// Authorizer 授权接口，引擎在执行每个对外操作前调用，返回错误时拒绝该操作
+// actor 操作人(上下文中通过NewActorContext设定的操作人，未设定时为操作的处理人)
+type Authorizer interface {
+	Authorize(ctx context.Context, actor string, action Action, resource *Resource) error
+}
+
+// AuthorizerFunc 函数形式的授权
+type AuthorizerFunc func(ctx context.Context, actor string, action Action, resource *Resource) error
+
+// Authorize 授权
+func (f AuthorizerFunc) Authorize(ctx context.Context, actor string, action Action, resource *Resource) error {
+	return f(ctx, actor, action, resource)
+}
+
+// AuthorizerOption 设定授权，默认仅按流程定义的可发起人校验发起流程的操作
+func AuthorizerOption(a Authorizer) Option {
+	return func(o *engineOptions) {
+		o.authorizer = a
+	}
+}
+
+// GroupsFunc 获取用户所属的用户组
+type GroupsFunc func(ctx context.Context, userID string) ([]string, error)
+
+// NewStarterAuthorizer 创建按可发起人校验发起流程的授权，其他操作均允许
+// 流程未设定可发起人时所有人都可以发起，groups为nil时仅校验可发起的用户
+func NewStarterAuthorizer(groups GroupsFunc) Authorizer {
+	return AuthorizerFunc(func(ctx context.Context, actor string, action Action, resource *Resource) error {
+		if action != ActionStart {
+			return nil
+		}
+		return CheckPotentialStarter(ctx, actor, resource, groups)
+	})
+}
+
+// CheckPotentialStarter 检查操作人是否是流程的可发起人
+func CheckPotentialStarter(ctx context.Context, actor string, resource *Resource, groups GroupsFunc) error {
+	if len(resource.CandidateStarterUsers) == 0 && len(resource.CandidateStarterGroups) == 0 {
+		return nil
+	}
+
+	for _, u := range resource.CandidateStarterUsers {
+		if u == actor {
+			return nil
+		}
+	}
+
+	if groups != nil && len(resource.CandidateStarterGroups) > 0 {
+		userGroups, err := groups(ctx, actor)
+		if err != nil {
+			return err
+		}
+		for _, g := range userGroups {
+			for _, sg := range resource.CandidateStarterGroups {
+				if g == sg {
+					return nil
+				}
+			}
+		}
+	}
+	return ErrForbidden
+}
+
+// 获取操作人，上下文中未设定时使用操作的处理人
+func actorOf(ctx context.Context, userID string) string {
+	if actor, _, ok := FromActorContext(ctx); ok {
+		return actor
+	}
+	return userID
+}
+
+// 执行授权
+func (e *Engine) authorize(ctx context.Context, userID string, action Action, resource *Resource) error {
+	return e.authorizer.Authorize(ctx, actorOf(ctx, userID), action, resource)
+}
+
+// 授权流程实例的操作，流程实例不存在(或属于其他租户)时返回ErrNotFound
+func (e *Engine) authorizeFlowInstance(ctx context.Context, userID string, action Action, flowInstanceID string) (*model.FlowInstance, error) {
+	flowInstance, err := e.flowSvc.GetFlowInstance(ctx, flowInstanceID)
+	if err != nil {
+		return nil, err
+	} else if flowInstance == nil {
+		return nil, ErrNotFound
+	}
+
+	err = e.authorize(ctx, userID, action, &Resource{FlowInstance: flowInstance})
+	if err != nil {
+		return nil, err
+	}
+	return flowInstance, nil
+}
+
+// 授权节点实例的操作，节点实例不存在(或属于其他租户)时返回ErrNotFound
+func (e *Engine) authorizeNodeInstance(ctx context.Context, userID string, action Action, nodeInstanceID string) error {
+	nodeInstance, err := e.flowSvc.GetNodeInstance(ctx, nodeInstanceID)
+	if err != nil {
+		return err
+	} else if nodeInstance == nil {
+		return ErrNotFound
+	}
+
+	flowInstance, err := e.flowSvc.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
+	if err != nil {
+		return err
+	} else if flowInstance == nil {
+		return ErrNotFound
+	}
+
+	return e.authorize(ctx, userID, action, &Resource{FlowInstance: flowInstance, NodeInstance: nodeInstance})
+}
+
+// 授权发起流程，提供流程及其可发起人
+func (e *Engine) authorizeStart(ctx context.Context, flowCode, userID string) error {
+	flow, err := e.flowSvc.GetFlowByCode(ctx, flowCode)
+	if err != nil {
+		return err
+	} else if flow == nil {
+		return errors.New("未找到流程信息")
+	}
+
+	props, err := e.flowSvc.GetFlowProperty(ctx, flow.RecordID)
+	if err != nil {
+		return err
+	}
+
+	return e.authorize(ctx, userID, ActionStart, &Resource{
+		FlowCode:               flowCode,
+		Flow:                   flow,
+		CandidateStarterUsers:  splitProperty(props[CandidateStarterUsersProperty]),
+		CandidateStarterGroups: splitProperty(props[CandidateStarterGroupsProperty]),
+	})
+}
+
+// 拆分逗号分隔的属性值
+func splitProperty(v string) []string {
+	var items []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			items = append(items, s)
+		}
+	}
+	return items
+}
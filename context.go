@@ -2,14 +2,90 @@ package kitten
 
 import (
 	"context"
+
+	"github.com/chapin666/kitten/pkg/metadata"
 )
 
 type (
-	flagKey struct{}
+	idempotencyKeyKey struct{}
 )
 
+// NewMetadataContext 创建携带调用元数据(租户、标志、请求ID、操作人)的上下文
+// 元数据随流程实例、节点实例、节点定时、异步作业及实例历史一同保存，定时及作业执行时恢复到上下文中
+func NewMetadataContext(ctx context.Context, md *metadata.Metadata) context.Context {
+	return metadata.NewContext(ctx, md)
+}
+
+// FromMetadataContext 从上下文中获取调用元数据
+func FromMetadataContext(ctx context.Context) *metadata.Metadata {
+	return metadata.FromContext(ctx)
+}
+
+// NewFlagContext 创建携带flag的上下文，flag将保存到节点定时及异步作业中
+func NewFlagContext(ctx context.Context, flag string) context.Context {
+	return metadata.WithFlag(ctx, flag)
+}
+
 // FromFlagContext 获取flag的上下文
 func FromFlagContext(ctx context.Context) (string, bool) {
-	flag, ok := ctx.Value(flagKey{}).(string)
-	return flag, ok
+	flag := metadata.FromContext(ctx).Flag
+	return flag, flag != ""
+}
+
+// NewTenantContext 创建携带租户的上下文
+// 流程定义、流程实例、节点实例及待办按租户隔离，未设定租户时使用默认(空)租户
+func NewTenantContext(ctx context.Context, tenantID string) context.Context {
+	return metadata.WithTenant(ctx, tenantID)
+}
+
+// FromTenantContext 从上下文中获取租户
+func FromTenantContext(ctx context.Context) (string, bool) {
+	tenantID := metadata.FromContext(ctx).TenantID
+	return tenantID, tenantID != ""
+}
+
+// NewRequestIDContext 创建携带请求ID的上下文
+func NewRequestIDContext(ctx context.Context, requestID string) context.Context {
+	return metadata.WithRequestID(ctx, requestID)
+}
+
+// FromRequestIDContext 从上下文中获取请求ID
+func FromRequestIDContext(ctx context.Context) (string, bool) {
+	requestID := metadata.FromContext(ctx).RequestID
+	return requestID, requestID != ""
+}
+
+// NewActorContext 创建携带操作人及其属性的上下文
+func NewActorContext(ctx context.Context, actor string, attributes map[string]string) context.Context {
+	return metadata.WithActor(ctx, actor, attributes)
+}
+
+// FromActorContext 从上下文中获取操作人及其属性
+func FromActorContext(ctx context.Context) (string, map[string]string, bool) {
+	md := metadata.FromContext(ctx)
+	return md.Actor, md.Attributes, md.Actor != ""
+}
+
+// 恢复保存的调用元数据到上下文中(兼容仅保存了flag的数据)
+func restoreMetadataContext(ctx context.Context, data, flag string) context.Context {
+	md, err := metadata.Parse(data)
+	if err != nil || md.IsEmpty() {
+		if flag == "" {
+			return ctx
+		}
+		return NewFlagContext(ctx, flag)
+	}
+	return metadata.NewContext(ctx, md)
+}
+
+// NewIdempotencyKeyContext 创建携带幂等键的上下文
+// 启动流程及处理流程节点时，相同幂等键的重复请求直接返回首次请求的处理结果
+func NewIdempotencyKeyContext(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// FromIdempotencyKeyContext 从上下文中获取幂等键
+func FromIdempotencyKeyContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyKey{}).(string)
+	return key, ok && key != ""
 }
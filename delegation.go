@@ -0,0 +1,41 @@
+package kitten
+
+import (
+	"context"
+
+	"github.com/chapin666/kitten/model"
+)
+
+// CreateDelegationRule 创建委托规则
+// 委托人在有效期内新产生的待办将转交给受托人处理，FlowCode为空时适用于所有流程，待办中保留原处理人
+func (e *Engine) CreateDelegationRule(ctx context.Context, rule *model.DelegationRule) error {
+	err := e.authorize(ctx, rule.Delegator, ActionDelegate, &Resource{FlowCode: rule.FlowCode, DelegationRule: rule})
+	if err != nil {
+		return err
+	}
+	return e.flowSvc.CreateDelegationRule(ctx, rule)
+}
+
+// DeleteDelegationRule 删除委托规则(已转交的待办不会收回)
+func (e *Engine) DeleteDelegationRule(ctx context.Context, recordID string) error {
+	rule, err := e.flowSvc.GetDelegationRule(ctx, recordID)
+	if err != nil {
+		return err
+	} else if rule == nil {
+		return ErrNotFound
+	}
+
+	err = e.authorize(ctx, rule.Delegator, ActionDelegate, &Resource{FlowCode: rule.FlowCode, DelegationRule: rule})
+	if err != nil {
+		return err
+	}
+	return e.flowSvc.DeleteDelegationRule(ctx, recordID)
+}
+
+// QueryDelegationRules 查询委托人的委托规则，delegator为空时查询所有委托规则
+func (e *Engine) QueryDelegationRules(ctx context.Context, delegator string) ([]*model.DelegationRule, error) {
+	if err := e.authorize(ctx, delegator, ActionRead, &Resource{}); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.QueryDelegationRules(ctx, delegator)
+}
@@ -2,39 +2,101 @@ package kitten
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/chapin666/kitten/mapper"
 	"github.com/chapin666/kitten/model"
 	"github.com/chapin666/kitten/pkg/db"
+	"github.com/chapin666/kitten/pkg/identity"
+	"github.com/chapin666/kitten/pkg/logger"
+	"github.com/chapin666/kitten/pkg/metadata"
+	"github.com/chapin666/kitten/pkg/metrics"
 	"github.com/chapin666/kitten/pkg/parse"
 	"github.com/chapin666/kitten/pkg/parse/xml"
+	"github.com/chapin666/kitten/pkg/tracing"
 	"github.com/chapin666/kitten/pkg/util"
 	"github.com/chapin666/kitten/service"
 	"github.com/facebookgo/inject"
 	"github.com/pkg/errors"
-	"log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Engine .
 type Engine struct {
-	parser  parse.Parser
-	execer  Execer
-	flowSvc *service.Flow
+	parser    parse.Parser
+	execer    Execer
+	flowSvc   *service.Flow
+	listeners listenerRegistry
+	logger    logger.Logger
+	tracer    trace.Tracer
+	metrics   metrics.Collector
+	codes     codeCache
+
+	authorizer Authorizer
+	identity   identity.Provider
+
+	traceExpressions bool
+}
+
+type engineOptions struct {
+	logger         logger.Logger
+	tracerProvider trace.TracerProvider
+	metrics        metrics.Collector
+	authorizer     Authorizer
+	identity       identity.Provider
+}
+
+// Option 引擎配置
+type Option func(*engineOptions)
+
+// LoggerOption 设定日志(引擎、表达式及数据库追踪的输出)，默认输出到标准错误
+func LoggerOption(l logger.Logger) Option {
+	return func(o *engineOptions) {
+		o.logger = l
+	}
+}
+
+// TracerProviderOption 设定OpenTelemetry的TracerProvider，默认使用全局的TracerProvider
+// 引擎操作、节点流转、表达式执行及数据库操作都会创建span
+func TracerProviderOption(tp trace.TracerProvider) Option {
+	return func(o *engineOptions) {
+		o.tracerProvider = tp
+	}
+}
+
+// MetricsOption 设定指标收集器(例如pkg/metrics/prom)
+// 流程实例的发起、完成、停止，节点停留时长及表达式执行耗时由引擎记录，待办数量及定时积压通过RefreshMetrics刷新
+func MetricsOption(c metrics.Collector) Option {
+	return func(o *engineOptions) {
+		o.metrics = c
+	}
 }
 
 // 初始化
-func New(mysqlDNS string, trace bool) (*Engine, error) {
+func New(mysqlDNS string, trace bool, options ...Option) (*Engine, error) {
+	opts := &engineOptions{
+		logger:         logger.Default(),
+		tracerProvider: otel.GetTracerProvider(),
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+
 	var g inject.Graph
 	var flowSvc service.Flow
 
-	sqlDB, trace, err := db.NewMySQL(db.SetDSN(mysqlDNS), db.SetTrace(trace))
+	sqlDB, trace, err := db.NewMySQL(db.SetDSN(mysqlDNS), db.SetTrace(trace), db.SetLogger(opts.logger))
 	if err != nil {
 		return nil, err
 	}
-	dbInstance := db.NewMySQLWithDB(sqlDB, trace)
+	dbInstance := db.NewMySQLWithDB(sqlDB, trace, db.SetLogger(opts.logger))
 
 	if err := g.Provide(&inject.Object{Value: dbInstance}, &inject.Object{Value: &flowSvc}); err != nil {
 		return nil, err
@@ -49,27 +111,55 @@ func New(mysqlDNS string, trace bool) (*Engine, error) {
 		return nil, err
 	}
 
-	return &Engine{
+	// 迁移已存在的表结构(补充新增字段、扩容大文本字段)
+	if err := dbInstance.MigrateTables(); err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
 		parser:  xml.NewXMLParser(),
 		execer:  NewQLangExecer(),
 		flowSvc: &flowSvc,
-	}, nil
+		logger:  opts.logger,
+		tracer:  opts.tracerProvider.Tracer(tracing.InstrumentationName),
+		metrics: metrics.Nop(),
+
+		authorizer: opts.authorizer,
+		identity:   opts.identity,
+	}
+	if e.authorizer == nil {
+		var groups GroupsFunc
+		if e.identity != nil {
+			groups = e.identity.UserGroups
+		}
+		e.authorizer = NewStarterAuthorizer(groups)
+	}
+	if opts.metrics != nil {
+		e.metrics = opts.metrics
+		e.enableMetrics()
+	}
+	return e, nil
 }
 
 // 部署
-func (e *Engine) Deploy(filePath string) (string, error) {
+func (e *Engine) Deploy(ctx context.Context, filePath string) (string, error) {
 	// 读取并解析bpmn文件
 	data, err := util.ReadFile(filePath)
 	if err != nil {
 		return "", err
 	}
-	result, err := e.parser.Parse(context.Background(), data)
+	result, err := e.parser.Parse(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	err = e.authorize(ctx, "", ActionDeploy, &Resource{FlowCode: result.FlowID})
 	if err != nil {
 		return "", err
 	}
 
 	// 检查流程是否存在，如果存在则检查版本号是否一致，如果不一致则创建新流程
-	oldFlow, err := e.flowSvc.GetFlowByCode(result.FlowID)
+	oldFlow, err := e.flowSvc.GetFlowByCode(ctx, result.FlowID)
 	if err != nil {
 		return "", err
 	}
@@ -92,6 +182,7 @@ func (e *Engine) Deploy(filePath string) (string, error) {
 	}
 
 	nodeOperating, formOperating := e.parseOperating(flow, result.Nodes)
+	nodeOperating.FlowPropertyGroup = e.parseFlowProperties(flow, result)
 
 	// 解析节点表单数据
 	for _, node := range result.Nodes {
@@ -116,7 +207,7 @@ func (e *Engine) Deploy(filePath string) (string, error) {
 		}
 	}
 
-	err = e.flowSvc.CreateFlow(flow, nodeOperating, formOperating)
+	err = e.flowSvc.CreateFlow(ctx, flow, nodeOperating, formOperating)
 	if err != nil {
 		return "", err
 	}
@@ -144,6 +235,12 @@ func (e *Engine) parseOperating(flow *model.Flow, nodeResults []*parse.NodeResul
 			OrderNum: strconv.FormatInt(int64(i+10), 10),
 			Created:  flow.Created,
 		}
+		if n.AsyncBefore {
+			node.AsyncBefore = 1
+		}
+		if n.AsyncAfter {
+			node.AsyncAfter = 1
+		}
 
 		if n.FormResult != nil {
 			e.parseFormOperating(formOperating, flow, node, n.FormResult)
@@ -184,8 +281,15 @@ func (e *Engine) parseOperating(flow *model.Flow, nodeResults []*parse.NodeResul
 			})
 		}
 
-		// 增加节点属性
-		for _, p := range n.Properties {
+		// 增加节点属性(候选组作为节点属性保存)
+		properties := n.Properties
+		if len(n.CandidateGroups) > 0 {
+			properties = append(properties, &parse.PropertyResult{
+				Name:  CandidateGroupsProperty,
+				Value: strings.Join(n.CandidateGroups, ","),
+			})
+		}
+		for _, p := range properties {
 			nodeOperating.PropertyGroup = append(nodeOperating.PropertyGroup, &model.NodeProperty{
 				RecordID: util.UUID(),
 				NodeID:   getNodeRecordID(n.NodeID),
@@ -199,6 +303,37 @@ func (e *Engine) parseOperating(flow *model.Flow, nodeResults []*parse.NodeResul
 	return nodeOperating, formOperating
 }
 
+// 解析流程属性
+func (e *Engine) parseFlowProperties(flow *model.Flow, result *parse.ParseResult) []*model.FlowProperty {
+	properties := result.Properties
+
+	// 可发起人保存为流程属性
+	if len(result.CandidateStarterUsers) > 0 {
+		properties = append(properties, &parse.PropertyResult{
+			Name:  CandidateStarterUsersProperty,
+			Value: strings.Join(result.CandidateStarterUsers, ","),
+		})
+	}
+	if len(result.CandidateStarterGroups) > 0 {
+		properties = append(properties, &parse.PropertyResult{
+			Name:  CandidateStarterGroupsProperty,
+			Value: strings.Join(result.CandidateStarterGroups, ","),
+		})
+	}
+
+	var items []*model.FlowProperty
+	for _, p := range properties {
+		items = append(items, &model.FlowProperty{
+			RecordID: util.UUID(),
+			FlowID:   flow.RecordID,
+			Name:     p.Name,
+			Value:    p.Value,
+			Created:  flow.Created,
+		})
+	}
+	return items
+}
+
 // 解析form
 func (e *Engine) parseFormOperating(
 	formOperating *model.FormOperating,
@@ -295,15 +430,19 @@ func (e *Engine) parseFormOperating(
 }
 
 // SaveFlow 保存流程
-func (e *Engine) SaveFlow(data []byte) (string, error) {
+func (e *Engine) SaveFlow(ctx context.Context, data []byte) (string, error) {
+	result, err := e.parser.Parse(ctx, data)
+	if err != nil {
+		return "", err
+	}
 
-	result, err := e.parser.Parse(context.Background(), data)
+	err = e.authorize(ctx, "", ActionDeploy, &Resource{FlowCode: result.FlowID})
 	if err != nil {
 		return "", err
 	}
 
 	// 检查流程是否存在，如果存在则检查版本号是否一致，如果不一致则创建新流程
-	oldFlow, err := e.flowSvc.GetFlowByCode(result.FlowID)
+	oldFlow, err := e.flowSvc.GetFlowByCode(ctx, result.FlowID)
 	if err != nil {
 		return "", err
 	} else if oldFlow != nil {
@@ -322,6 +461,7 @@ func (e *Engine) SaveFlow(data []byte) (string, error) {
 		Created:  time.Now().Unix(),
 	}
 	nodeOperating, formOperating := e.parseOperating(flow, result.Nodes)
+	nodeOperating.FlowPropertyGroup = e.parseFlowProperties(flow, result)
 
 	// 解析节点表单数据
 	for _, node := range result.Nodes {
@@ -346,7 +486,7 @@ func (e *Engine) SaveFlow(data []byte) (string, error) {
 		}
 	}
 
-	err = e.flowSvc.CreateFlow(flow, nodeOperating, formOperating)
+	err = e.flowSvc.CreateFlow(ctx, flow, nodeOperating, formOperating)
 	if err != nil {
 		return "", err
 	}
@@ -354,6 +494,7 @@ func (e *Engine) SaveFlow(data []byte) (string, error) {
 }
 
 // 启动流程
+// 可以通过NewIdempotencyKeyContext设定幂等键，重复的请求返回首次启动的处理结果
 func (e *Engine) StartFlow(
 	ctx context.Context,
 	flowCode string,
@@ -361,15 +502,124 @@ func (e *Engine) StartFlow(
 	userID string,
 	inputData []byte,
 ) (*model.HandleResult, error) {
-	nodeInstance, err := e.flowSvc.LaunchFlowInstance(flowCode, nodeCode, userID, inputData)
+	ctx = logger.NewFieldsContext(ctx, append(requestLogFields(ctx), logger.F(logger.FlowCodeKey, flowCode))...)
+	ctx, span := e.startSpan(ctx, "kitten.StartFlow",
+		tracing.FlowCodeKey.String(flowCode),
+		tracing.NodeCodeKey.String(nodeCode),
+		tracing.UserIDKey.String(userID),
+	)
+
+	if err := e.authorizeStart(ctx, flowCode, userID); err != nil {
+		e.endSpan(span, nil, err)
+		return nil, err
+	}
+
+	// 发起流程实例及流转在同一事务中执行，发生错误时回滚所有数据变更
+	fingerprint := requestFingerprint(flowCode, nodeCode, userID, string(inputData))
+	result, err := e.execIdempotent(ctx, model.IdempotencyOperationStart, fingerprint, func(ctx context.Context) (*model.HandleResult, error) {
+		nodeInstance, err := e.flowSvc.LaunchFlowInstance(ctx, flowCode, nodeCode, userID, inputData)
+		if err != nil {
+			return nil, err
+		}
+		if nodeInstance == nil {
+			return nil, errors.New("未找到流程信息")
+		}
+
+		flowInstance, err := e.flowSvc.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
+		if err != nil {
+			return nil, err
+		}
+		err = e.fire(ctx, &Event{
+			Type:         EventFlowStarted,
+			FlowInstance: flowInstance,
+			NodeInstance: nodeInstance,
+			Operator:     userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return e.nextFlowHandle(ctx, nodeInstance.RecordID, userID, inputData)
+	})
+	e.endSpan(span, result, err)
+	return result, err
+}
+
+// 创建引擎操作的span
+func (e *Engine) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return e.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// 结束引擎操作的span，记录流程实例及错误
+func (e *Engine) endSpan(span trace.Span, result *model.HandleResult, err error) {
+	if result != nil && result.FlowInstance != nil {
+		span.SetAttributes(tracing.FlowInstanceIDKey.String(result.FlowInstance.RecordID))
+	}
+	tracing.End(span, err)
+}
+
+// 在事务中执行流程操作
+// 上下文中存在幂等键时，重复的请求直接返回首次请求的处理结果，处理结果及请求指纹与数据变更在同一事务中保存
+// 幂等键已被请求指纹不同的请求使用时返回ErrIdempotencyMismatch
+func (e *Engine) execIdempotent(
+	ctx context.Context,
+	operation string,
+	fingerprint string,
+	fn func(context.Context) (*model.HandleResult, error),
+) (*model.HandleResult, error) {
+	key, ok := FromIdempotencyKeyContext(ctx)
+
+	var result *model.HandleResult
+	err := e.execTrans(ctx, func(ctx context.Context) error {
+		var err error
+		if ok {
+			result, err = e.getIdempotentResult(ctx, key, operation, fingerprint)
+			if err != nil || result != nil {
+				return err
+			}
+		}
+
+		result, err = fn(ctx)
+		if err != nil || !ok {
+			return err
+		}
+		return e.flowSvc.SaveIdempotentResult(ctx, key, operation, fingerprint, result)
+	})
 	if err != nil {
+		if ok && db.IsDuplicate(err) {
+			// 并发的重复请求在保存幂等记录时失败，返回已提交请求的处理结果
+			prev, perr := e.getIdempotentResult(ctx, key, operation, fingerprint)
+			if perr != nil {
+				return nil, perr
+			} else if prev != nil {
+				return prev, nil
+			}
+		}
 		return nil, err
 	}
-	if nodeInstance == nil {
-		return nil, errors.New("未找到流程信息")
+	return result, nil
+}
+
+// 获取幂等键对应的处理结果，并检查与当前请求的指纹是否一致(未记录指纹的历史数据不检查)
+func (e *Engine) getIdempotentResult(ctx context.Context, key, operation, fingerprint string) (*model.HandleResult, error) {
+	result, prev, err := e.flowSvc.GetIdempotentResult(ctx, key, operation)
+	if err != nil || result == nil {
+		return nil, err
 	}
+	if prev != "" && prev != fingerprint {
+		return nil, ErrIdempotencyMismatch
+	}
+	return result, nil
+}
 
-	return e.nextFlowHandle(ctx, nodeInstance.RecordID, userID, inputData)
+// 计算请求指纹(操作对象、处理人及输入数据的摘要)
+func requestFingerprint(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 func (e *Engine) nextFlowHandle(
@@ -380,6 +630,25 @@ func (e *Engine) nextFlowHandle(
 ) (*model.HandleResult, error) {
 	var result model.HandleResult
 
+	// 合并输入数据到流程实例变量，后续节点的表达式可以通过vars访问
+	nodeInstance, err := e.flowSvc.GetNodeInstance(ctx, nodeInstanceID)
+	if err != nil {
+		return nil, err
+	} else if nodeInstance == nil {
+		return nil, ErrNotFound
+	}
+
+	// 锁定流程实例，并行分支的流转依次执行，避免汇聚及结束检查读取到对方未提交的状态
+	err = e.flowSvc.LockFlowInstance(ctx, nodeInstance.FlowInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.flowSvc.MergeInputVariables(ctx, nodeInstance.FlowInstanceID, inputData)
+	if err != nil {
+		return nil, err
+	}
+
 	var onNextNode = OnNextNodeOption(func(
 		node *model.Node,
 		nodeInstance *model.NodeInstance,
@@ -400,7 +669,11 @@ func (e *Engine) nextFlowHandle(
 		result.IsEnd = true
 	})
 
-	nr, err := new(NodeRouter).Init(ctx, e, nodeInstanceID, inputData, onNextNode, onFlowEnd)
+	var onTrace = OnTraceOption(func(trace *model.ExpressionTrace) {
+		result.Traces = append(result.Traces, trace)
+	})
+
+	nr, err := new(NodeRouter).Init(ctx, e, nodeInstanceID, inputData, onNextNode, onFlowEnd, onTrace)
 	if err != nil {
 		return nil, err
 	}
@@ -413,19 +686,20 @@ func (e *Engine) nextFlowHandle(
 
 	if !result.IsEnd {
 		for _, item := range result.NextNodes {
-			prop, err := e.flowSvc.GetNodeProperty(item.Node.RecordID)
+			prop, err := e.flowSvc.GetNodeProperty(ctx, item.Node.RecordID)
 			if err != nil {
 				return nil, err
 			}
 
-			// 检查节点是否设定定时器，如果设定则加入定时
-			if v := prop["timing"]; v != "" {
+			// 检查节点是否设定定时器，如果设定则加入定时(没有处理人的节点不加入)
+			if v := prop["timing"]; v != "" && len(item.CandidateIDs) > 0 {
 				expired, err := strconv.Atoi(v)
 				if err == nil && expired > 0 {
 					nt := &model.NodeTiming{
 						NodeInstanceID: item.NodeInstance.RecordID,
 						Processor:      item.CandidateIDs[0],
 						Input:          prop["timing_input"],
+						Metadata:       metadata.Encode(ctx),
 						ExpiredAt:      time.Now().Add(time.Duration(expired) * time.Minute).Unix(),
 						Created:        time.Now().Unix(),
 					}
@@ -434,9 +708,9 @@ func (e *Engine) nextFlowHandle(
 						nt.Flag = flag
 					}
 
-					err = e.flowSvc.CreateNodeTiming(nt)
+					err = e.flowSvc.CreateNodeTiming(ctx, nt)
 					if err != nil {
-						e.errorf("%+v", err)
+						e.logError(ctx, "创建节点定时发生错误", err, logger.F(logger.NodeInstanceIDKey, nt.NodeInstanceID))
 					}
 				}
 			}
@@ -450,14 +724,58 @@ func (e *Engine) nextFlowHandle(
 // nodeInstanceID 节点实例内码
 // userID 处理人
 // inputData 输入数据
+// 可以通过NewIdempotencyKeyContext设定幂等键，重复的请求返回首次处理的结果
 func (e *Engine) HandleFlow(
 	ctx context.Context,
 	nodeInstanceID,
 	userID string,
 	inputData []byte,
 ) (*model.HandleResult, error) {
-	// 检查是否是节点候选人
-	exists, err := e.flowSvc.CheckNodeCandidate(nodeInstanceID, userID)
+	ctx = logger.NewFieldsContext(ctx, append(requestLogFields(ctx), logger.F(logger.NodeInstanceIDKey, nodeInstanceID))...)
+	ctx, span := e.startSpan(ctx, "kitten.HandleFlow",
+		tracing.NodeInstanceIDKey.String(nodeInstanceID),
+		tracing.UserIDKey.String(userID),
+	)
+
+	if err := e.authorizeNodeInstance(ctx, userID, ActionHandle, nodeInstanceID); err != nil {
+		e.endSpan(span, nil, err)
+		return nil, err
+	}
+
+	// 节点处理及流转在同一事务中执行，发生错误时回滚所有数据变更
+	fingerprint := requestFingerprint(nodeInstanceID, userID, string(inputData))
+	result, err := e.execIdempotent(ctx, model.IdempotencyOperationHandle, fingerprint, func(ctx context.Context) (*model.HandleResult, error) {
+		return e.handleFlow(ctx, nodeInstanceID, userID, inputData)
+	})
+	e.endSpan(span, result, err)
+	return result, err
+}
+
+func (e *Engine) handleFlow(
+	ctx context.Context,
+	nodeInstanceID,
+	userID string,
+	inputData []byte,
+) (*model.HandleResult, error) {
+	nodeInstance, err := e.flowSvc.GetNodeInstance(ctx, nodeInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if nodeInstance == nil || nodeInstance.Status != 1 {
+		return nil, fmt.Errorf("无效的处理节点")
+	}
+
+	// 检查流程实例是否在进行中(暂停、停止或完成的流程实例不允许处理)
+	flowInstance, err := e.flowSvc.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if flowInstance == nil || flowInstance.Status != 1 {
+		return nil, fmt.Errorf("流程实例未在进行中")
+	}
+
+	// 检查是否是节点处理人
+	exists, err := e.flowSvc.CheckNodeHandler(ctx, nodeInstance, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -465,41 +783,231 @@ func (e *Engine) HandleFlow(
 		return nil, fmt.Errorf("无效的节点处理人")
 	}
 
-	nodeInstance, err := e.flowSvc.GetNodeInstance(nodeInstanceID)
+	// 委派中的节点实例需要被委派人解决后归还委派人处理
+	if nodeInstance.DelegateStatus == 1 {
+		return nil, fmt.Errorf("节点实例正在委派中，请先解决委派")
+	}
+
+	// 前加签节点实例处理完成后恢复来源节点实例，不进行流转
+	if nodeInstance.AddSignType == model.AddSignTypeBefore {
+		err = e.flowSvc.MergeInputVariables(ctx, nodeInstance.FlowInstanceID, inputData)
+		if err != nil {
+			return nil, err
+		}
+
+		err = e.flowSvc.DoneAddSignNodeInstance(ctx, nodeInstance, userID, inputData)
+		if err != nil {
+			return nil, err
+		}
+
+		nodeInstance.Processor = userID
+		nodeInstance.Status = 2
+		err = e.fire(ctx, &Event{
+			Type:         EventNodeCompleted,
+			FlowInstance: flowInstance,
+			NodeInstance: nodeInstance,
+			Operator:     userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return e.pendingHandleResult(ctx, nodeInstance.ParentID)
+	}
+
+	return e.nextFlowHandle(ctx, nodeInstanceID, userID, inputData)
+}
+
+// AddSignBefore 前加签
+// 当前节点实例等待加签人处理，加签人处理完成后恢复由当前处理人处理
+// nodeInstanceID 节点实例内码
+// userID 当前处理人
+// signUserIDs 加签人
+func (e *Engine) AddSignBefore(
+	ctx context.Context,
+	nodeInstanceID,
+	userID string,
+	signUserIDs []string,
+) (*model.HandleResult, error) {
+	return e.addSign(ctx, nodeInstanceID, userID, model.AddSignTypeBefore, signUserIDs, nil)
+}
+
+// AddSignAfter 后加签
+// 当前处理人完成当前节点实例，加签人处理完成后继续流向原节点的下一节点
+// nodeInstanceID 节点实例内码
+// userID 当前处理人
+// signUserIDs 加签人
+// inputData 输入数据
+func (e *Engine) AddSignAfter(
+	ctx context.Context,
+	nodeInstanceID,
+	userID string,
+	signUserIDs []string,
+	inputData []byte,
+) (*model.HandleResult, error) {
+	return e.addSign(ctx, nodeInstanceID, userID, model.AddSignTypeAfter, signUserIDs, inputData)
+}
+
+// 加签并通知加签节点实例的事件，加签与事件的同步监听在同一事务中执行
+// 可以通过NewIdempotencyKeyContext设定幂等键，重复的请求返回首次处理的结果
+func (e *Engine) addSign(
+	ctx context.Context,
+	nodeInstanceID,
+	userID string,
+	signType int64,
+	signUserIDs []string,
+	inputData []byte,
+) (*model.HandleResult, error) {
+	if err := e.authorizeNodeInstance(ctx, userID, ActionHandle, nodeInstanceID); err != nil {
+		return nil, err
+	}
+
+	fingerprint := requestFingerprint(nodeInstanceID, userID, strconv.FormatInt(signType, 10), strings.Join(signUserIDs, ","), string(inputData))
+	return e.execIdempotent(ctx, model.IdempotencyOperationAddSign, fingerprint, func(ctx context.Context) (*model.HandleResult, error) {
+		source, err := e.flowSvc.GetNodeInstance(ctx, nodeInstanceID)
+		if err != nil {
+			return nil, err
+		} else if source == nil {
+			return nil, ErrNotFound
+		}
+
+		nodeInstance, err := e.flowSvc.AddSignNodeInstance(ctx, nodeInstanceID, userID, signType, signUserIDs, inputData)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := e.pendingHandleResult(ctx, nodeInstance.RecordID)
+		if err != nil {
+			return nil, err
+		}
+		next := result.NextNodes[0]
+
+		// 后加签由当前处理人完成来源节点实例
+		if signType == model.AddSignTypeAfter {
+			source.Processor = userID
+			source.Status = 2
+			err = e.fire(ctx, &Event{
+				Type:         EventNodeCompleted,
+				FlowInstance: result.FlowInstance,
+				Node:         next.Node,
+				NodeInstance: source,
+				Operator:     userID,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = e.fire(ctx, &Event{
+			Type:         EventNodeInstanceCreated,
+			FlowInstance: result.FlowInstance,
+			NodeInstance: next.NodeInstance,
+			CandidateIDs: next.CandidateIDs,
+			Operator:     userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = e.fire(ctx, &Event{
+			Type:         EventTaskAssigned,
+			FlowInstance: result.FlowInstance,
+			Node:         next.Node,
+			NodeInstance: next.NodeInstance,
+			CandidateIDs: next.CandidateIDs,
+			Operator:     userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+}
+
+// 组织待处理节点实例的处理结果，下一处理节点为该节点实例(候选人为办理人或节点候选人)
+func (e *Engine) pendingHandleResult(ctx context.Context, nodeInstanceID string) (*model.HandleResult, error) {
+	nodeInstance, err := e.flowSvc.GetNodeInstance(ctx, nodeInstanceID)
 	if err != nil {
 		return nil, err
+	} else if nodeInstance == nil {
+		return nil, ErrNotFound
 	}
-	if nodeInstance == nil || nodeInstance.Status != 1 {
-		return nil, fmt.Errorf("无效的处理节点")
+
+	node, err := e.flowSvc.GetNode(ctx, nodeInstance.NodeID)
+	if err != nil {
+		return nil, err
+	} else if node == nil {
+		return nil, ErrNotFound
 	}
 
-	return e.nextFlowHandle(ctx, nodeInstanceID, userID, inputData)
+	flowInstance, err := e.flowSvc.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	var cIDs []string
+	if nodeInstance.Assignee != "" {
+		cIDs = append(cIDs, nodeInstance.Assignee)
+	} else {
+		candidates, err := e.flowSvc.QueryNodeCandidates(ctx, nodeInstance.RecordID)
+		if err != nil {
+			return nil, err
+		}
+		for _, nc := range candidates {
+			cIDs = append(cIDs, nc.CandidateID)
+		}
+	}
+
+	return &model.HandleResult{
+		NextNodes: []*model.NextNode{
+			{Node: node, NodeInstance: nodeInstance, CandidateIDs: cIDs},
+		},
+		FlowInstance: flowInstance,
+	}, nil
 }
 
 // QueryAllFlowPage 查询流程分页数据
-func (e *Engine) QueryAllFlowPage(params model.FlowQueryParam, pageIndex, pageSize uint) (
+func (e *Engine) QueryAllFlowPage(ctx context.Context, params model.FlowQueryParam, pageIndex, pageSize uint) (
 	int64,
 	[]*model.FlowQueryResult,
 	error,
 ) {
-	return e.flowSvc.QueryAllFlowPage(params, pageIndex, pageSize)
+	if err := e.authorize(ctx, "", ActionRead, &Resource{FlowCode: params.Code}); err != nil {
+		return 0, nil, err
+	}
+	return e.flowSvc.QueryAllFlowPage(ctx, params, pageIndex, pageSize)
 }
 
 // GetFlow 获取流程数据
-func (e *Engine) GetFlow(recordID string) (*model.Flow, error) {
-	return e.flowSvc.GetFlow(recordID)
+func (e *Engine) GetFlow(ctx context.Context, recordID string) (*model.Flow, error) {
+	flow, err := e.flowSvc.GetFlow(ctx, recordID)
+	if err != nil || flow == nil {
+		return nil, err
+	}
+
+	err = e.authorize(ctx, "", ActionRead, &Resource{FlowCode: flow.Code, Flow: flow})
+	if err != nil {
+		return nil, err
+	}
+	return flow, nil
 }
 
 // QueryTodoFlows 查询流程待办数据
 // flowCode 流程编号
 // userID 待办人
-func (e *Engine) QueryTodoFlows(flowCode string, userID string, limit int) ([]*model.FlowTodoResult, error) {
-	return e.flowSvc.QueryTodo("", flowCode, userID, limit)
+func (e *Engine) QueryTodoFlows(ctx context.Context, flowCode string, userID string, limit int) ([]*model.FlowTodoResult, error) {
+	if err := e.authorize(ctx, userID, ActionRead, &Resource{FlowCode: flowCode}); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.QueryTodo(ctx, "", flowCode, userID, limit)
 }
 
 // QueryNodeCandidates 查询节点实例的候选人ID列表
-func (e *Engine) QueryNodeCandidates(nodeInstanceID string) ([]string, error) {
-	candidates, err := e.flowSvc.QueryNodeCandidates(nodeInstanceID)
+func (e *Engine) QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]string, error) {
+	if err := e.authorizeNodeInstance(ctx, "", ActionRead, nodeInstanceID); err != nil {
+		return nil, err
+	}
+
+	candidates, err := e.flowSvc.QueryNodeCandidates(ctx, nodeInstanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -513,14 +1021,96 @@ func (e *Engine) QueryNodeCandidates(nodeInstanceID string) ([]string, error) {
 	return ids, nil
 }
 
+// ClaimNodeInstance 签收节点实例
+// 签收后节点实例仅由签收人处理，其他候选人的待办中不再显示
+func (e *Engine) ClaimNodeInstance(ctx context.Context, nodeInstanceID, userID string) error {
+	return e.reassignNodeInstance(ctx, nodeInstanceID, userID, func(ctx context.Context) error {
+		return e.flowSvc.ClaimNodeInstance(ctx, nodeInstanceID, userID)
+	})
+}
+
+// UnclaimNodeInstance 取消签收节点实例
+func (e *Engine) UnclaimNodeInstance(ctx context.Context, nodeInstanceID, userID string) error {
+	return e.reassignNodeInstance(ctx, nodeInstanceID, userID, func(ctx context.Context) error {
+		return e.flowSvc.UnclaimNodeInstance(ctx, nodeInstanceID, userID)
+	})
+}
+
+// TransferNodeInstance 转办节点实例
+// userID 当前处理人
+// targetID 接收人
+func (e *Engine) TransferNodeInstance(ctx context.Context, nodeInstanceID, userID, targetID string) error {
+	return e.reassignNodeInstance(ctx, nodeInstanceID, userID, func(ctx context.Context) error {
+		return e.flowSvc.TransferNodeInstance(ctx, nodeInstanceID, userID, targetID)
+	})
+}
+
+// DelegateNodeInstance 委派节点实例
+// 被委派人通过 ResolveNodeInstance 解决后，节点实例归还委派人继续处理
+// userID 当前处理人(委派人)
+// targetID 被委派人
+func (e *Engine) DelegateNodeInstance(ctx context.Context, nodeInstanceID, userID, targetID string) error {
+	return e.reassignNodeInstance(ctx, nodeInstanceID, userID, func(ctx context.Context) error {
+		return e.flowSvc.DelegateNodeInstance(ctx, nodeInstanceID, userID, targetID)
+	})
+}
+
+// ResolveNodeInstance 解决委派的节点实例
+// userID 被委派人
+// inputData 处理意见等输入数据(记录到实例历史)
+func (e *Engine) ResolveNodeInstance(ctx context.Context, nodeInstanceID, userID string, inputData []byte) error {
+	return e.reassignNodeInstance(ctx, nodeInstanceID, userID, func(ctx context.Context) error {
+		return e.flowSvc.ResolveNodeInstance(ctx, nodeInstanceID, userID, inputData)
+	})
+}
+
+// 在事务中变更节点实例的办理人，并通知人工任务分配事件(CandidateIDs为变更后的办理人或候选人)
+// 同步监听返回错误时否决本次变更
+func (e *Engine) reassignNodeInstance(ctx context.Context, nodeInstanceID, userID string, fn func(context.Context) error) error {
+	if err := e.authorizeNodeInstance(ctx, userID, ActionHandle, nodeInstanceID); err != nil {
+		return err
+	}
+
+	return e.execTrans(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+
+		result, err := e.pendingHandleResult(ctx, nodeInstanceID)
+		if err != nil {
+			return err
+		}
+		next := result.NextNodes[0]
+		return e.fire(ctx, &Event{
+			Type:         EventTaskAssigned,
+			FlowInstance: result.FlowInstance,
+			Node:         next.Node,
+			NodeInstance: next.NodeInstance,
+			CandidateIDs: next.CandidateIDs,
+			Operator:     userID,
+		})
+	})
+}
+
 // QueryDoneFlowIDs 查询已办理的流程实例ID列表
-func (e *Engine) QueryDoneFlowIDs(flowCode, userID string) ([]string, error) {
-	return e.flowSvc.QueryDoneIDs(flowCode, userID)
+func (e *Engine) QueryDoneFlowIDs(ctx context.Context, flowCode, userID string) ([]string, error) {
+	if err := e.authorize(ctx, userID, ActionRead, &Resource{FlowCode: flowCode}); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.QueryDoneIDs(ctx, flowCode, userID)
 }
 
 // StopFlowInstance 停止流程实例
-func (e *Engine) StopFlowInstance(flowInstanceID string, allowStop func(*model.FlowInstance) bool) error {
-	flowInstance, err := e.flowSvc.GetFlowInstance(flowInstanceID)
+// 流程实例状态变更为已停止，所有未完成的节点实例将被关闭
+func (e *Engine) StopFlowInstance(ctx context.Context, flowInstanceID string, allowStop func(*model.FlowInstance) bool) error {
+	flowInstance, err := e.flowSvc.GetFlowInstance(ctx, flowInstanceID)
+	if err != nil {
+		return err
+	} else if flowInstance == nil {
+		return ErrNotFound
+	}
+
+	err = e.authorize(ctx, "", ActionStop, &Resource{FlowInstance: flowInstance})
 	if err != nil {
 		return err
 	}
@@ -528,15 +1118,171 @@ func (e *Engine) StopFlowInstance(flowInstanceID string, allowStop func(*model.F
 	if allowStop != nil && !allowStop(flowInstance) {
 		return errors.New("不允许停止流程")
 	}
-	return e.flowSvc.StopFlowInstance(flowInstanceID)
+
+	return e.execTrans(ctx, func(ctx context.Context) error {
+		err := e.flowSvc.StopFlowInstance(ctx, flowInstanceID)
+		if err != nil {
+			return err
+		}
+
+		// 重新获取停止后的流程实例(状态及更新时间)
+		stopped, err := e.flowSvc.GetFlowInstance(ctx, flowInstanceID)
+		if err != nil {
+			return err
+		} else if stopped == nil {
+			return ErrNotFound
+		}
+		return e.fire(ctx, &Event{Type: EventFlowStopped, FlowInstance: stopped})
+	})
+}
+
+// SuspendFlowInstance 暂停流程实例
+// 暂停期间流程实例不可处理，待办及定时均不生效
+func (e *Engine) SuspendFlowInstance(ctx context.Context, flowInstanceID string) error {
+	if _, err := e.authorizeFlowInstance(ctx, "", ActionSuspend, flowInstanceID); err != nil {
+		return err
+	}
+	return e.flowSvc.SuspendFlowInstance(ctx, flowInstanceID)
+}
+
+// ResumeFlowInstance 恢复已暂停的流程实例
+func (e *Engine) ResumeFlowInstance(ctx context.Context, flowInstanceID string) error {
+	if _, err := e.authorizeFlowInstance(ctx, "", ActionSuspend, flowInstanceID); err != nil {
+		return err
+	}
+	return e.flowSvc.ResumeFlowInstance(ctx, flowInstanceID)
+}
+
+// QueryIncidents 查询未处理的流程事件(自动执行的步骤失败后需要人工干预的事件)
+// flowInstanceID 流程实例内码，为空时查询所有流程实例
+func (e *Engine) QueryIncidents(ctx context.Context, flowInstanceID string) ([]*model.Incident, error) {
+	if flowInstanceID != "" {
+		if _, err := e.authorizeFlowInstance(ctx, "", ActionRead, flowInstanceID); err != nil {
+			return nil, err
+		}
+	} else if err := e.authorize(ctx, "", ActionRead, &Resource{}); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.QueryIncidents(ctx, flowInstanceID)
+}
+
+// RetryIncident 重试流程事件，失败的异步作业重新由作业执行器执行
+// retries 重试次数，小于等于0时使用默认的重试次数
+func (e *Engine) RetryIncident(ctx context.Context, incidentID, userID string, retries int) error {
+	if err := e.authorizeIncident(ctx, incidentID, userID); err != nil {
+		return err
+	}
+	return e.flowSvc.RetryIncident(ctx, incidentID, userID, int64(retries))
+}
+
+// ResolveIncident 人工解决流程事件，失败的异步作业不再执行
+func (e *Engine) ResolveIncident(ctx context.Context, incidentID, userID string) error {
+	if err := e.authorizeIncident(ctx, incidentID, userID); err != nil {
+		return err
+	}
+	return e.flowSvc.ResolveIncident(ctx, incidentID, userID)
+}
+
+// 授权流程事件的操作
+func (e *Engine) authorizeIncident(ctx context.Context, incidentID, userID string) error {
+	incident, err := e.flowSvc.GetIncident(ctx, incidentID)
+	if err != nil {
+		return err
+	} else if incident == nil {
+		return ErrNotFound
+	}
+
+	_, err = e.authorizeFlowInstance(ctx, userID, ActionUpdate, incident.FlowInstanceID)
+	return err
+}
+
+// ViewNodeInstance 查看节点实例，并记录查看历史
+func (e *Engine) ViewNodeInstance(ctx context.Context, nodeInstanceID, userID string) (*model.NodeInstance, error) {
+	if err := e.authorizeNodeInstance(ctx, userID, ActionRead, nodeInstanceID); err != nil {
+		return nil, err
+	}
+
+	nodeInstance, err := e.flowSvc.ViewNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return nil, err
+	} else if nodeInstance == nil {
+		return nil, ErrNotFound
+	}
+	return nodeInstance, nil
+}
+
+// EnableExpressionTrace 启用表达式执行记录的持久化
+// 流转中执行的路由条件和指派人表达式(表达式、输入数据、结果或错误、耗时)与流转在同一事务中保存
+// 表达式执行失败的记录在事务外保存，流转回滚后仍可查询
+func (e *Engine) EnableExpressionTrace() {
+	e.traceExpressions = true
+}
+
+// QueryExpressionTrace 查询流程实例的表达式执行记录(需要启用EnableExpressionTrace)
+func (e *Engine) QueryExpressionTrace(ctx context.Context, flowInstanceID string) ([]*model.ExpressionTrace, error) {
+	if _, err := e.authorizeFlowInstance(ctx, "", ActionRead, flowInstanceID); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.QueryExpressionTrace(ctx, flowInstanceID)
+}
+
+// QueryInstanceHistory 查询流程实例的历史(发起、查看、处理、路由决策等操作)，按操作顺序排列
+func (e *Engine) QueryInstanceHistory(ctx context.Context, flowInstanceID string) ([]*model.InstanceHistory, error) {
+	if _, err := e.authorizeFlowInstance(ctx, "", ActionRead, flowInstanceID); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.QueryInstanceHistory(ctx, flowInstanceID)
+}
+
+// GetVariables 获取流程实例变量
+// scope 作用域(空字符串表示流程实例级别，节点实例内码表示节点级别)
+func (e *Engine) GetVariables(ctx context.Context, flowInstanceID, scope string) (map[string]interface{}, error) {
+	if _, err := e.authorizeFlowInstance(ctx, "", ActionRead, flowInstanceID); err != nil {
+		return nil, err
+	}
+	return e.flowSvc.GetVariables(ctx, flowInstanceID, scope)
+}
+
+// SetVariables 设置流程实例变量，已存在的同名变量将被覆盖
+// 只有进行中或暂停的流程实例可以修改变量
+// scope 作用域(空字符串表示流程实例级别，节点实例内码表示节点级别)
+func (e *Engine) SetVariables(ctx context.Context, flowInstanceID, scope string, vars map[string]interface{}) error {
+	if _, err := e.authorizeFlowInstance(ctx, "", ActionUpdate, flowInstanceID); err != nil {
+		return err
+	}
+	return e.flowSvc.SetVariables(ctx, flowInstanceID, scope, vars)
 }
 
 // DeleteFlow 删除流程
-func (e *Engine) DeleteFlow(flowID string) error {
-	return e.flowSvc.DeleteFlow(flowID)
+func (e *Engine) DeleteFlow(ctx context.Context, flowID string) error {
+	flow, err := e.flowSvc.GetFlow(ctx, flowID)
+	if err != nil {
+		return err
+	} else if flow == nil {
+		return ErrNotFound
+	}
+
+	err = e.authorize(ctx, "", ActionDelete, &Resource{FlowCode: flow.Code, Flow: flow})
+	if err != nil {
+		return err
+	}
+	return e.flowSvc.DeleteFlow(ctx, flowID)
 }
 
+// 获取调用元数据中的请求ID及租户日志字段
+func requestLogFields(ctx context.Context) []logger.Field {
+	var fields []logger.Field
+	md := metadata.FromContext(ctx)
+	if md.RequestID != "" {
+		fields = append(fields, logger.F(logger.RequestIDKey, md.RequestID))
+	}
+	if md.TenantID != "" {
+		fields = append(fields, logger.F(logger.TenantIDKey, md.TenantID))
+	}
+	return fields
+}
 
-func (e *Engine) errorf(format string, args ...interface{}) {
-	log.Printf(format, args...)
+// 记录错误日志
+func (e *Engine) logError(ctx context.Context, msg string, err error, fields ...logger.Field) {
+	logger.Error(ctx, e.logger, msg, append(fields, logger.Err(err))...)
 }
@@ -3,9 +3,21 @@ package kitten
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/identity"
+	"github.com/chapin666/kitten/pkg/metadata"
+	"github.com/chapin666/kitten/pkg/publisher"
+	"github.com/chapin666/kitten/pkg/util"
+	"github.com/chapin666/kitten/pkg/webhook"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 )
 
 var (
@@ -22,8 +34,25 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// 发起请假流程，下一处理节点为班主任(F002)审批
+func startLeaveFlow(t *testing.T, ctx context.Context) *model.HandleResult {
+	t.Helper()
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := client.StartFlow(ctx, "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if len(result.NextNodes) == 0 {
+		t.Fatal("start flow should create the next node instance")
+	}
+	return result
+}
+
 func TestDeploy(t *testing.T) {
-	result, err := client.Deploy("./test_data/leave.xml")
+	result, err := client.Deploy(context.Background(), "./test_data/leave.xml")
 	if err != nil {
 		t.Errorf("deploy flow define failed: %s", err.Error())
 	}
@@ -33,7 +62,7 @@ func TestDeploy(t *testing.T) {
 func TestQueryAll(t *testing.T) {
 	params := model.FlowQueryParam{
 	}
-	total, result, err := client.QueryAllFlowPage(params, 1, 10)
+	total, result, err := client.QueryAllFlowPage(context.Background(), params, 1, 10)
 	if err != nil {
 		t.Errorf("query all flow page failed: %s", err.Error())
 	}
@@ -45,7 +74,7 @@ func TestQueryAll(t *testing.T) {
 }
 
 func TestGetFlow(t *testing.T) {
-	flow, err := client.GetFlow("7099d58c-8df2-4781-bace-8a439d3bae9c")
+	flow, err := client.GetFlow(context.Background(), "7099d58c-8df2-4781-bace-8a439d3bae9c")
 	if err != nil {
 		t.Errorf("get flow  failed: %s", err.Error())
 	}
@@ -68,11 +97,44 @@ func TestStartFlow(t *testing.T) {
 	t.Log(result)
 }
 
+func TestStartFlowIdempotent(t *testing.T) {
+	flowCode := "process_leave_test"
+	nodeCode := "node_start"
+	userID := "F001"
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	ctx := NewIdempotencyKeyContext(context.Background(), util.UUID())
+	result, err := client.StartFlow(ctx, flowCode, nodeCode, userID, input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	retry, err := client.StartFlow(ctx, flowCode, nodeCode, userID, input)
+	if err != nil {
+		t.Fatalf("retry start flow failed: %s", err.Error())
+	}
+	if retry.FlowInstance.RecordID != result.FlowInstance.RecordID {
+		t.Errorf("retry started flow instance %s, want %s", retry.FlowInstance.RecordID, result.FlowInstance.RecordID)
+	}
+
+	// 相同的幂等键用于不同的请求
+	other, _ := json.Marshal(map[string]interface{}{
+		"day": 2,
+		"bzr": "F002",
+	})
+	_, err = client.StartFlow(ctx, flowCode, nodeCode, userID, other)
+	if !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("start flow with a different input = %v, want ErrIdempotencyMismatch", err)
+	}
+}
+
 func TestQueryTodoFlows(t *testing.T) {
 	flowCode := "process_leave_test"
 	userID := "F002"
 	limit := 100
-	todos, err := client.QueryTodoFlows(flowCode, userID, limit)
+	todos, err := client.QueryTodoFlows(context.Background(), flowCode, userID, limit)
 	if err != nil {
 		t.Fatalf("query flow failed: %s", err.Error())
 	}
@@ -84,7 +146,7 @@ func TestQueryTodoFlows(t *testing.T) {
 
 func TestQueryNodeCandidates(t *testing.T) {
 	nodeInstanceID := "164f4a70-6d60-4447-b332-bfa8af875676"
-	userIDs, err := client.QueryNodeCandidates(nodeInstanceID)
+	userIDs, err := client.QueryNodeCandidates(context.Background(), nodeInstanceID)
 	if err != nil {
 		t.Errorf("query node candidate failed: %s", err.Error())
 	}
@@ -104,22 +166,907 @@ func TestHandleFlow(t *testing.T) {
 	t.Log(result)
 }
 
+func TestConcurrentHandleFlow(t *testing.T) {
+	nodeInstanceID := startLeaveFlow(t, context.Background()).NextNodes[0].NodeInstance.RecordID
+	userID := "F002"
+	input, _ := json.Marshal(map[string]interface{}{
+		"action": "pass",
+	})
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := client.HandleFlow(context.Background(), nodeInstanceID, userID, input)
+			errs <- err
+		}()
+	}
+
+	var done int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			done++
+		} else {
+			t.Logf("handle flow failed (conflict: %v): %s", IsConflict(err), err.Error())
+		}
+	}
+	if done != 1 {
+		t.Errorf("node instance completed %d times, want 1", done)
+	}
+
+	nodeInstance, err := client.flowSvc.GetNodeInstance(context.Background(), nodeInstanceID)
+	if err != nil {
+		t.Fatalf("get node instance failed: %s", err.Error())
+	}
+	if nodeInstance.Status != 2 || nodeInstance.Processor != userID {
+		t.Errorf("node instance status = %d, processor = %q", nodeInstance.Status, nodeInstance.Processor)
+	}
+}
+
+func TestConcurrentParallelBranches(t *testing.T) {
+	_, err := client.Deploy(context.Background(), "./test_data/parallel.xml")
+	if err != nil {
+		t.Fatalf("deploy flow failed: %s", err.Error())
+	}
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"a": "P001",
+		"b": "P002",
+	})
+	result, err := client.StartFlow(context.Background(), "process_parallel_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if len(result.NextNodes) != 2 {
+		t.Fatalf("parallel gateway should create 2 branches, got %d", len(result.NextNodes))
+	}
+
+	// 并发完成两个分支，汇聚网关只能在后完成的分支中通过
+	pass, _ := json.Marshal(map[string]interface{}{
+		"action": "pass",
+	})
+	errs := make(chan error, len(result.NextNodes))
+	for _, next := range result.NextNodes {
+		go func(next *model.NextNode) {
+			_, err := client.HandleFlow(context.Background(), next.NodeInstance.RecordID, next.CandidateIDs[0], pass)
+			errs <- err
+		}(next)
+	}
+	for range result.NextNodes {
+		if err := <-errs; err != nil {
+			t.Errorf("handle branch failed: %s", err.Error())
+		}
+	}
+
+	flowInstance, err := client.flowSvc.GetFlowInstance(context.Background(), result.FlowInstance.RecordID)
+	if err != nil {
+		t.Fatalf("get flow instance failed: %s", err.Error())
+	}
+	if flowInstance.Status != 9 {
+		t.Errorf("flow instance status = %d, want 9 after both branches completed", flowInstance.Status)
+	}
+}
+
+func TestAsyncContinuation(t *testing.T) {
+	_, err := client.Deploy(context.Background(), "./test_data/async.xml")
+	if err != nil {
+		t.Fatalf("deploy flow failed: %s", err.Error())
+	}
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"a": "P001",
+		"b": "P002",
+	})
+	result, err := client.StartFlow(context.Background(), "process_async_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	var asyncNode, syncNode *model.NodeInstance
+	for _, next := range result.NextNodes {
+		if next.Node.Code == "node_user_a" {
+			asyncNode = next.NodeInstance
+		} else {
+			syncNode = next.NodeInstance
+		}
+	}
+	if asyncNode == nil || syncNode == nil {
+		t.Fatalf("parallel gateway should create both branches, got %d", len(result.NextNodes))
+	}
+
+	// 进入节点前异步执行，作业执行前不能处理
+	pass, _ := json.Marshal(map[string]interface{}{
+		"action": "pass",
+	})
+	if _, err = client.HandleFlow(context.Background(), asyncNode.RecordID, "P001", pass); err == nil {
+		t.Error("handle should be rejected before the async before job is executed")
+	}
+
+	// 另一分支完成后，汇聚网关需要等待异步分支
+	_, err = client.HandleFlow(context.Background(), syncNode.RecordID, "P002", pass)
+	if err != nil {
+		t.Fatalf("handle branch failed: %s", err.Error())
+	}
+	assertFlowInstanceStatus(t, result.FlowInstance.RecordID, 1)
+
+	executor := client.NewJobExecutor()
+	if err = executor.ExecuteJobs(context.Background()); err != nil {
+		t.Fatalf("execute jobs failed: %s", err.Error())
+	}
+	nodeInstance, err := client.flowSvc.GetNodeInstance(context.Background(), asyncNode.RecordID)
+	if err != nil {
+		t.Fatalf("get node instance failed: %s", err.Error())
+	}
+	if nodeInstance.Status != 1 {
+		t.Fatalf("node instance status = %d, want 1 after the async before job", nodeInstance.Status)
+	}
+
+	// 离开节点后异步执行，作业执行前流程不能结束
+	_, err = client.HandleFlow(context.Background(), asyncNode.RecordID, "P001", pass)
+	if err != nil {
+		t.Fatalf("handle async branch failed: %s", err.Error())
+	}
+	assertFlowInstanceStatus(t, result.FlowInstance.RecordID, 1)
+
+	if err = executor.ExecuteJobs(context.Background()); err != nil {
+		t.Fatalf("execute jobs failed: %s", err.Error())
+	}
+	assertFlowInstanceStatus(t, result.FlowInstance.RecordID, 9)
+}
+
+func assertFlowInstanceStatus(t *testing.T, flowInstanceID string, status int64) {
+	t.Helper()
+	flowInstance, err := client.flowSvc.GetFlowInstance(context.Background(), flowInstanceID)
+	if err != nil {
+		t.Fatalf("get flow instance failed: %s", err.Error())
+	}
+	if flowInstance.Status != status {
+		t.Errorf("flow instance status = %d, want %d", flowInstance.Status, status)
+	}
+}
+
+func TestClaimNodeInstance(t *testing.T) {
+	nodeInstanceID := startLeaveFlow(t, context.Background()).NextNodes[0].NodeInstance.RecordID
+	userID := "F002"
+	err := client.ClaimNodeInstance(context.Background(), nodeInstanceID, userID)
+	if err != nil {
+		t.Fatalf("claim node instance failed: %s", err.Error())
+	}
+	nodeInstance := getNodeInstance(t, nodeInstanceID)
+	if nodeInstance.Status != 1 || nodeInstance.Assignee != userID {
+		t.Errorf("claimed node instance status = %d, assignee = %q", nodeInstance.Status, nodeInstance.Assignee)
+	}
+
+	err = client.UnclaimNodeInstance(context.Background(), nodeInstanceID, userID)
+	if err != nil {
+		t.Fatalf("unclaim node instance failed: %s", err.Error())
+	}
+	nodeInstance = getNodeInstance(t, nodeInstanceID)
+	if nodeInstance.Status != 1 || nodeInstance.Assignee != "" {
+		t.Errorf("unclaimed node instance status = %d, assignee = %q", nodeInstance.Status, nodeInstance.Assignee)
+	}
+}
+
+func TestDelegateNodeInstance(t *testing.T) {
+	nodeInstanceID := startLeaveFlow(t, context.Background()).NextNodes[0].NodeInstance.RecordID
+	userID := "F002"
+	targetID := "F003"
+	err := client.DelegateNodeInstance(context.Background(), nodeInstanceID, userID, targetID)
+	if err != nil {
+		t.Fatalf("delegate node instance failed: %s", err.Error())
+	}
+	nodeInstance := getNodeInstance(t, nodeInstanceID)
+	if nodeInstance.Status != 1 || nodeInstance.DelegateStatus != 1 ||
+		nodeInstance.Assignee != targetID || nodeInstance.Owner != userID {
+		t.Errorf("delegated node instance = %#v", nodeInstance)
+	}
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"comment": "agree",
+	})
+	err = client.ResolveNodeInstance(context.Background(), nodeInstanceID, targetID, input)
+	if err != nil {
+		t.Fatalf("resolve node instance failed: %s", err.Error())
+	}
+	nodeInstance = getNodeInstance(t, nodeInstanceID)
+	if nodeInstance.Status != 1 || nodeInstance.DelegateStatus != 2 || nodeInstance.Assignee != userID {
+		t.Errorf("resolved node instance = %#v", nodeInstance)
+	}
+}
+
+func getNodeInstance(t *testing.T, nodeInstanceID string) *model.NodeInstance {
+	t.Helper()
+	nodeInstance, err := client.flowSvc.GetNodeInstance(context.Background(), nodeInstanceID)
+	if err != nil {
+		t.Fatalf("get node instance failed: %s", err.Error())
+	}
+	return nodeInstance
+}
+
+func TestAddSignBefore(t *testing.T) {
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	started, err := client.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if len(started.NextNodes) == 0 {
+		t.Fatal("start flow should create the next node instance")
+	}
+	nodeInstanceID := started.NextNodes[0].NodeInstance.RecordID
+
+	result, err := client.AddSignBefore(context.Background(), nodeInstanceID, "F002", []string{"F004", "F005"})
+	if err != nil {
+		t.Fatalf("add sign before failed: %s", err.Error())
+	}
+
+	source, err := client.flowSvc.GetNodeInstance(context.Background(), nodeInstanceID)
+	if err != nil {
+		t.Fatalf("get node instance failed: %s", err.Error())
+	}
+	if source.Status != 3 {
+		t.Errorf("source node instance status = %d, want 3", source.Status)
+	}
+
+	if len(result.NextNodes) != 1 {
+		t.Fatalf("add sign should return the ad-hoc node instance, got %d", len(result.NextNodes))
+	}
+	next := result.NextNodes[0]
+	if next.NodeInstance.ParentID != nodeInstanceID || next.NodeInstance.AddSignType != model.AddSignTypeBefore {
+		t.Errorf("unexpected ad-hoc node instance: %#v", next.NodeInstance)
+	}
+	candidates := append([]string(nil), next.CandidateIDs...)
+	sort.Strings(candidates)
+	if fmt.Sprint(candidates) != "[F004 F005]" {
+		t.Errorf("ad-hoc node instance candidates = %v, want sign users", next.CandidateIDs)
+	}
+
+	// 加签人的输入数据合并到流程变量
+	opinion, _ := json.Marshal(map[string]interface{}{
+		"opinion": "agree",
+	})
+	_, err = client.HandleFlow(context.Background(), next.NodeInstance.RecordID, "F004", opinion)
+	if err != nil {
+		t.Fatalf("handle ad-hoc node instance failed: %s", err.Error())
+	}
+	vars, err := client.GetVariables(context.Background(), started.FlowInstance.RecordID, "")
+	if err != nil {
+		t.Fatalf("get variables failed: %s", err.Error())
+	}
+	if vars["opinion"] != "agree" {
+		t.Errorf("ad-hoc node instance input should be merged into variables, got %v", vars)
+	}
+}
+
 func TestQueryDoneFlowIDs(t *testing.T) {
 	flowCode := "process_leave_test"
 	userID := "T002"
-	ids, err := client.QueryDoneFlowIDs(flowCode, userID)
+	ids, err := client.QueryDoneFlowIDs(context.Background(), flowCode, userID)
 	if err != nil {
 		t.Errorf("query done flow ids failed: %s", err.Error())
 	}
 	t.Log(ids)
 }
 
+func TestSetVariables(t *testing.T) {
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	started, err := client.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	flowInstanceID := started.FlowInstance.RecordID
+
+	err = client.SetVariables(context.Background(), flowInstanceID, "", map[string]interface{}{
+		"day":    3,
+		"reason": "travel",
+		"dates":  []string{"2020-01-01", "2020-01-02"},
+	})
+	if err != nil {
+		t.Fatalf("set variables failed: %s", err.Error())
+	}
+
+	vars, err := client.GetVariables(context.Background(), flowInstanceID, "")
+	if err != nil {
+		t.Fatalf("get variables failed: %s", err.Error())
+	}
+	if vars["day"] != float64(3) || vars["reason"] != "travel" || vars["bzr"] != "F002" {
+		t.Errorf("unexpected variables: %v", vars)
+	}
+	if fmt.Sprint(vars["dates"]) != "[2020-01-01 2020-01-02]" {
+		t.Errorf("unexpected json variable: %v", vars["dates"])
+	}
+
+	err = client.flowSvc.MergeInputVariables(context.Background(), flowInstanceID, []byte(`["day"]`))
+	if err != nil {
+		t.Errorf("non-object input should be skipped: %s", err.Error())
+	}
+
+	err = client.StopFlowInstance(context.Background(), flowInstanceID, func(*model.FlowInstance) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatalf("stop flow instance failed: %s", err.Error())
+	}
+	err = client.SetVariables(context.Background(), flowInstanceID, "", map[string]interface{}{"day": 5})
+	if err == nil {
+		t.Error("variables of a stopped flow instance should not be updated")
+	}
+}
+
+func TestSuspendFlowInstance(t *testing.T) {
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	started, err := client.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if len(started.NextNodes) == 0 {
+		t.Fatal("start flow should create the next node instance")
+	}
+	flowInstanceID := started.FlowInstance.RecordID
+	nodeInstanceID := started.NextNodes[0].NodeInstance.RecordID
+
+	err = client.SuspendFlowInstance(context.Background(), flowInstanceID)
+	if err != nil {
+		t.Fatalf("suspend flow instance failed: %s", err.Error())
+	}
+
+	pass, _ := json.Marshal(map[string]interface{}{
+		"action": "pass",
+	})
+	_, err = client.HandleFlow(context.Background(), nodeInstanceID, "F002", pass)
+	if err == nil {
+		t.Error("suspended flow instance should not be handled")
+	}
+
+	err = client.ResumeFlowInstance(context.Background(), flowInstanceID)
+	if err != nil {
+		t.Fatalf("resume flow instance failed: %s", err.Error())
+	}
+
+	flowInstance, err := client.flowSvc.GetFlowInstance(context.Background(), flowInstanceID)
+	if err != nil {
+		t.Fatalf("get flow instance failed: %s", err.Error())
+	}
+	if flowInstance.Status != 1 {
+		t.Errorf("resumed flow instance status = %d, want 1", flowInstance.Status)
+	}
+}
+
 func TestStopFlowInstance(t *testing.T) {
 	nodeInstanceID := "4c66bea5-01fa-463f-8da5-bedb290e419e"
-	err := client.StopFlowInstance(nodeInstanceID, func(instance *model.FlowInstance) bool {
+	err := client.StopFlowInstance(context.Background(), nodeInstanceID, func(instance *model.FlowInstance) bool {
 		return true
 	})
 	if err != nil {
 		t.Errorf("hanle flow failed: %s", err.Error())
 	}
 }
+
+func TestExecuteJobs(t *testing.T) {
+	executor := client.NewJobExecutor(JobWorkersOption(2))
+	err := executor.ExecuteJobs(context.Background())
+	if err != nil {
+		t.Errorf("execute jobs failed: %s", err.Error())
+	}
+}
+
+func TestQueryIncidents(t *testing.T) {
+	incidents, err := client.QueryIncidents(context.Background(), "")
+	if err != nil {
+		t.Fatalf("query incidents failed: %s", err.Error())
+	}
+
+	for _, incident := range incidents {
+		t.Logf("%#v", incident)
+	}
+}
+
+func TestListener(t *testing.T) {
+	// 使用独立的引擎，避免监听影响其他测试
+	e, err := New(mysqlDNS, false)
+	if err != nil {
+		t.Fatalf("create engine failed: %s", err.Error())
+	}
+
+	var (
+		events []*Event
+		veto   bool
+	)
+	e.AddListener(func(ctx context.Context, event *Event) error {
+		if veto {
+			return fmt.Errorf("veto %s", event.Type)
+		}
+		events = append(events, event)
+		return nil
+	}, EventFlowStarted, EventTaskAssigned)
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := e.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if len(events) == 0 || events[0].Type != EventFlowStarted {
+		t.Fatalf("events = %v, want flow started first", events)
+	}
+	if len(result.NextNodes) == 0 {
+		t.Fatal("start flow should create the next node instance")
+	}
+	nodeInstanceID := result.NextNodes[0].NodeInstance.RecordID
+
+	// 同步监听否决签收
+	veto = true
+	if err = e.ClaimNodeInstance(context.Background(), nodeInstanceID, "F002"); err == nil {
+		t.Error("claim should be vetoed by the sync listener")
+	}
+	veto = false
+	nodeInstance, err := e.flowSvc.GetNodeInstance(context.Background(), nodeInstanceID)
+	if err != nil {
+		t.Fatalf("get node instance failed: %s", err.Error())
+	}
+	if nodeInstance.Assignee != "" {
+		t.Errorf("vetoed claim should be rolled back, assignee = %q", nodeInstance.Assignee)
+	}
+
+	err = e.ClaimNodeInstance(context.Background(), nodeInstanceID, "F002")
+	if err != nil {
+		t.Fatalf("claim node instance failed: %s", err.Error())
+	}
+	last := events[len(events)-1]
+	if last.Type != EventTaskAssigned || fmt.Sprint(last.CandidateIDs) != "[F002]" {
+		t.Errorf("claim should fire task assigned to the assignee, got %s %v", last.Type, last.CandidateIDs)
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	ch := make(chan *publisher.Message, 100)
+	relay := client.NewOutboxRelay(publisher.NewChanPublisher(ch), OutboxBatchSizeOption(100))
+	err := relay.Relay(context.Background())
+	if err != nil {
+		t.Errorf("relay outbox failed: %s", err.Error())
+	}
+	close(ch)
+
+	for msg := range ch {
+		t.Logf("%s %s", msg.Topic, msg.Payload)
+	}
+}
+
+func TestWebhookEventEnabled(t *testing.T) {
+	if !webhookEventEnabled("", EventTaskAssigned) || webhookEventEnabled("", EventFlowStarted) {
+		t.Error("default webhook events should be task_assigned and flow_ended")
+	}
+	if !webhookEventEnabled("flow_started, flow_ended", EventFlowEnded) || webhookEventEnabled("flow_started", EventFlowEnded) {
+		t.Error("webhook events should match the configured list")
+	}
+	if !webhookEventEnabled("flow_started,node_completed", EventNodeCompleted) {
+		t.Error("any event type can be configured for webhooks")
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	deliveries := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveries <- r.Header.Get(webhook.HeaderDelivery)
+	}))
+	defer srv.Close()
+
+	// 流程属性配置通知地址，版本号保证每次部署新的流程
+	data := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:camunda="http://camunda.org/schema/1.0/bpmn" id="Definitions_webhook">
+    <bpmn:process id="process_webhook_test" isExecutable="true" name="通知测试" camunda:versionTag="%d">
+        <bpmn:extensionElements>
+            <camunda:properties>
+                <camunda:property name="webhook_url" value="%s"/>
+                <camunda:property name="webhook_events" value="flow_started"/>
+            </camunda:properties>
+        </bpmn:extensionElements>
+        <bpmn:startEvent id="node_start" name="开始">
+            <bpmn:outgoing>flow_start_end</bpmn:outgoing>
+        </bpmn:startEvent>
+        <bpmn:endEvent id="node_end" name="结束">
+            <bpmn:incoming>flow_start_end</bpmn:incoming>
+        </bpmn:endEvent>
+        <bpmn:sequenceFlow id="flow_start_end" sourceRef="node_start" targetRef="node_end"/>
+    </bpmn:process>
+</definitions>`, time.Now().UnixNano(), srv.URL)
+	filePath := filepath.Join(t.TempDir(), "webhook.xml")
+	if err := os.WriteFile(filePath, []byte(data), 0644); err != nil {
+		t.Fatalf("write flow file failed: %s", err.Error())
+	}
+
+	// 使用独立的引擎，避免发件箱影响其他测试
+	e, err := New(mysqlDNS, false)
+	if err != nil {
+		t.Fatalf("create engine failed: %s", err.Error())
+	}
+	e.EnableOutbox(EventFlowStarted)
+	if _, err = e.Deploy(context.Background(), filePath); err != nil {
+		t.Fatalf("deploy flow failed: %s", err.Error())
+	}
+	if _, err = e.StartFlow(context.Background(), "process_webhook_test", "node_start", "F001", []byte(`{}`)); err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	relay := e.NewOutboxRelay(e.NewWebhookPublisher(), OutboxBatchSizeOption(1000))
+	if err = relay.Relay(context.Background()); err != nil {
+		t.Fatalf("relay outbox failed: %s", err.Error())
+	}
+	select {
+	case id := <-deliveries:
+		if id == "" {
+			t.Error("webhook delivery id should be the outbox id")
+		}
+	default:
+		t.Error("webhook should be delivered by the outbox relay")
+	}
+}
+
+func TestQueryInstanceHistory(t *testing.T) {
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := client.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	items, err := client.QueryInstanceHistory(context.Background(), result.FlowInstance.RecordID)
+	if err != nil {
+		t.Fatalf("query instance history failed: %s", err.Error())
+	}
+	if len(items) == 0 || items[0].Action != model.HistoryActionStart {
+		t.Errorf("first history should be start, got %v", items)
+	}
+}
+
+func TestExpressionTrace(t *testing.T) {
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := client.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	for _, trace := range result.Traces {
+		t.Logf("%s %s => %s %s (%dus)", trace.Kind, trace.Expression, trace.Result, trace.Error, trace.Duration)
+	}
+	if len(result.Traces) == 0 {
+		t.Error("expression traces should be attached to the handle result")
+	}
+}
+
+func TestFailedExpressionTrace(t *testing.T) {
+	// 使用独立的引擎，避免表达式执行记录影响其他测试
+	e, err := New(mysqlDNS, false)
+	if err != nil {
+		t.Fatalf("create engine failed: %s", err.Error())
+	}
+	e.EnableExpressionTrace()
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := e.StartFlow(context.Background(), "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if len(result.NextNodes) == 0 {
+		t.Fatal("start flow should create the next node instance")
+	}
+	nodeInstance := result.NextNodes[0].NodeInstance
+
+	// 表达式执行失败时流转的事务回滚，执行记录仍需保存
+	exp := "[]string{undefined_func(}"
+	err = e.flowSvc.ExecTrans(context.Background(), func(ctx context.Context) error {
+		r, err := new(NodeRouter).Init(ctx, e, nodeInstance.RecordID, input)
+		if err != nil {
+			return err
+		}
+		_, err = r.execStringSlice(nodeInstance.NodeID, exp)
+		return err
+	})
+	if err == nil {
+		t.Fatal("invalid expression should return error")
+	}
+
+	traces, err := e.QueryExpressionTrace(context.Background(), result.FlowInstance.RecordID)
+	if err != nil {
+		t.Fatalf("query expression trace failed: %s", err.Error())
+	}
+	var found bool
+	for _, trace := range traces {
+		if trace.Expression == exp && trace.Error != "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("failed expression trace should be persisted after rollback")
+	}
+}
+
+func TestMetadataContext(t *testing.T) {
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	ctx := NewRequestIDContext(context.Background(), "req-001")
+	ctx = NewActorContext(ctx, "F001", map[string]string{"dept": "D001"})
+	result, err := client.StartFlow(ctx, "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	md, err := metadata.Parse(result.FlowInstance.Metadata)
+	if err != nil {
+		t.Fatalf("parse metadata failed: %s", err.Error())
+	}
+	if md.RequestID != "req-001" || md.Actor != "F001" || md.Attributes["dept"] != "D001" {
+		t.Errorf("unexpected flow instance metadata: %s", result.FlowInstance.Metadata)
+	}
+
+	items, err := client.QueryInstanceHistory(context.Background(), result.FlowInstance.RecordID)
+	if err != nil {
+		t.Fatalf("query instance history failed: %s", err.Error())
+	}
+	if len(items) == 0 || items[0].Metadata != result.FlowInstance.Metadata {
+		t.Errorf("history should record the call metadata, got %v", items)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	ctx := NewTenantContext(context.Background(), "tenant_a")
+	_, err := client.Deploy(ctx, "./test_data/leave.xml")
+	if err != nil {
+		t.Fatalf("deploy flow failed: %s", err.Error())
+	}
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := client.StartFlow(ctx, "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+	if result.FlowInstance.TenantID != "tenant_a" {
+		t.Errorf("flow instance should belong to tenant_a, got %q", result.FlowInstance.TenantID)
+	}
+
+	_, err = client.QueryInstanceHistory(context.Background(), result.FlowInstance.RecordID)
+	if err != ErrNotFound {
+		t.Errorf("other tenants should not read the flow instance, got %v", err)
+	}
+
+	todos, err := client.QueryTodoFlows(context.Background(), "process_leave_test", "F002", 100)
+	if err != nil {
+		t.Fatalf("query todo flows failed: %s", err.Error())
+	}
+	for _, todo := range todos {
+		if todo.FlowInstanceID == result.FlowInstance.RecordID {
+			t.Error("todo of tenant_a should not be visible to the default tenant")
+		}
+	}
+}
+
+func TestCheckPotentialStarter(t *testing.T) {
+	resource := &Resource{
+		CandidateStarterUsers:  []string{"F001"},
+		CandidateStarterGroups: []string{"hr"},
+	}
+	groups := func(ctx context.Context, userID string) ([]string, error) {
+		if userID == "F002" {
+			return []string{"hr"}, nil
+		}
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	if err := CheckPotentialStarter(ctx, "F001", resource, nil); err != nil {
+		t.Errorf("F001 should be allowed: %v", err)
+	}
+	if err := CheckPotentialStarter(ctx, "F002", resource, groups); err != nil {
+		t.Errorf("F002 should be allowed by group: %v", err)
+	}
+	if err := CheckPotentialStarter(ctx, "F003", resource, groups); err != ErrForbidden {
+		t.Errorf("F003 should be forbidden, got %v", err)
+	}
+	if err := CheckPotentialStarter(ctx, "F003", &Resource{}, nil); err != nil {
+		t.Errorf("flow without potential starters should allow everyone: %v", err)
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	engine, err := New(mysqlDNS, false, AuthorizerOption(AuthorizerFunc(
+		func(ctx context.Context, actor string, action Action, resource *Resource) error {
+			if action == ActionStart && actor != "F001" {
+				return ErrForbidden
+			}
+			return nil
+		},
+	)))
+	if err != nil {
+		t.Fatalf("create engine failed: %s", err.Error())
+	}
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	ctx := NewActorContext(context.Background(), "F009", nil)
+	_, err = engine.StartFlow(ctx, "process_leave_test", "node_start", "F001", input)
+	if err != ErrForbidden {
+		t.Errorf("actor F009 should not start the flow, got %v", err)
+	}
+}
+
+func TestResolveCandidates(t *testing.T) {
+	m := identity.NewMemory()
+	m.AddUser(&identity.User{ID: "F001", Department: "D1", Manager: "F010"})
+	m.AddUser(&identity.User{ID: "F002", Department: "D1"}, "hr")
+	m.AddUser(&identity.User{ID: "F003", Department: "D2"}, "hr")
+
+	e := &Engine{identity: m}
+	props := map[string]string{
+		CandidateGroupsProperty:       "hr",
+		CandidateManagerOfProperty:    "launcher",
+		CandidateDepartmentOfProperty: "launcher",
+	}
+	candidates, err := e.resolveCandidates(context.Background(), props, []string{"F002"}, "F001", "F003")
+	if err != nil {
+		t.Fatalf("resolve candidates failed: %s", err.Error())
+	}
+	if fmt.Sprint(candidates) != "[F002 F003 F010 F001]" {
+		t.Errorf("unexpected candidates: %v", candidates)
+	}
+
+	_, err = new(Engine).resolveCandidates(context.Background(), props, nil, "F001", "")
+	if err == nil {
+		t.Error("candidate groups without identity provider should return error")
+	}
+}
+
+func TestAssignCandidates(t *testing.T) {
+	e := new(Engine)
+	ctx := context.Background()
+	candidates := []string{"F001", "F002"}
+
+	result, err := e.assignCandidates(ctx, "node", map[string]string{AssignStrategyProperty: AssignStrategyFirst}, candidates, true)
+	if err != nil || fmt.Sprint(result) != "[F001]" {
+		t.Errorf("first strategy = %v, %v", result, err)
+	}
+
+	result, err = e.assignCandidates(ctx, "node", map[string]string{FallbackAssigneeProperty: "F009"}, nil, true)
+	if err != nil || fmt.Sprint(result) != "[F009]" {
+		t.Errorf("fallback assignee = %v, %v", result, err)
+	}
+
+	if _, err = e.assignCandidates(ctx, "node", nil, nil, true); err == nil {
+		t.Error("empty candidates without fallback should return error")
+	}
+	if _, err = e.assignCandidates(ctx, "node", map[string]string{AssignStrategyProperty: "unknown"}, candidates, true); err == nil {
+		t.Error("unknown strategy should return error")
+	}
+
+	if c := minCandidate([]string{"F001", "F002", "F003"}, map[string]int64{"F001": 3, "F002": 1, "F003": 1}); c != "F002" {
+		t.Errorf("min candidate = %s", c)
+	}
+}
+
+func TestDelegationRule(t *testing.T) {
+	ctx := NewTenantContext(context.Background(), "tenant_delegation")
+	_, err := client.Deploy(ctx, "./test_data/leave.xml")
+	if err != nil {
+		t.Fatalf("deploy flow failed: %s", err.Error())
+	}
+
+	now := time.Now().Unix()
+	rule := &model.DelegationRule{
+		Delegator: "F002",
+		Delegate:  "F003",
+		FlowCode:  "process_leave_test",
+		StartTime: now - 60,
+		EndTime:   now + 3600,
+	}
+	err = client.CreateDelegationRule(ctx, rule)
+	if err != nil {
+		t.Fatalf("create delegation rule failed: %s", err.Error())
+	}
+	defer client.DeleteDelegationRule(ctx, rule.RecordID)
+
+	input, _ := json.Marshal(map[string]interface{}{
+		"day": 1,
+		"bzr": "F002",
+	})
+	result, err := client.StartFlow(ctx, "process_leave_test", "node_start", "F001", input)
+	if err != nil {
+		t.Fatalf("start flow define failed: %s", err.Error())
+	}
+
+	todos, err := client.QueryTodoFlows(ctx, "process_leave_test", "F003", 100)
+	if err != nil {
+		t.Fatalf("query todo flows failed: %s", err.Error())
+	}
+	var found bool
+	for _, todo := range todos {
+		if todo.FlowInstanceID == result.FlowInstance.RecordID {
+			found = true
+			if todo.OriginalAssignee != "F002" {
+				t.Errorf("original assignee = %q, want F002", todo.OriginalAssignee)
+			}
+		}
+	}
+	if !found {
+		t.Error("delegated todo should be visible to the delegate")
+	}
+}
+
+func TestDelegationRoundRobin(t *testing.T) {
+	ctx := NewTenantContext(context.Background(), "tenant_round_robin_"+util.UUID()[:8])
+	_, err := client.Deploy(ctx, "./test_data/leave.xml")
+	if err != nil {
+		t.Fatalf("deploy flow failed: %s", err.Error())
+	}
+
+	now := time.Now().Unix()
+	rule := &model.DelegationRule{
+		Delegator: "F021",
+		Delegate:  "F023",
+		StartTime: now - 60,
+		EndTime:   now + 3600,
+	}
+	err = client.CreateDelegationRule(ctx, rule)
+	if err != nil {
+		t.Fatalf("create delegation rule failed: %s", err.Error())
+	}
+	defer client.DeleteDelegationRule(ctx, rule.RecordID)
+
+	// F022先被指派，F021(已委托给F023)后被指派
+	var nodeID string
+	for _, bzr := range []string{"F022", "F021"} {
+		input, _ := json.Marshal(map[string]interface{}{
+			"day": 1,
+			"bzr": bzr,
+		})
+		result, err := client.StartFlow(ctx, "process_leave_test", "node_start", "F001", input)
+		if err != nil {
+			t.Fatalf("start flow define failed: %s", err.Error())
+		}
+		if len(result.NextNodes) == 0 {
+			t.Fatal("start flow should create the next node instance")
+		}
+		nodeID = result.NextNodes[0].Node.RecordID
+	}
+
+	props := map[string]string{AssignStrategyProperty: AssignStrategyRoundRobin}
+	result, err := client.assignCandidates(ctx, nodeID, props, []string{"F021", "F022"}, true)
+	if err != nil || fmt.Sprint(result) != "[F022]" {
+		t.Errorf("round robin with delegation = %v, %v", result, err)
+	}
+
+	props = map[string]string{AssignStrategyProperty: AssignStrategyLeastLoaded}
+	result, err = client.assignCandidates(ctx, nodeID, props, []string{"F022", "F021"}, true)
+	if err != nil || fmt.Sprint(result) != "[F022]" {
+		t.Errorf("least loaded with delegation = %v, %v", result, err)
+	}
+}
+
+func TestDelegationRuleValidate(t *testing.T) {
+	err := client.CreateDelegationRule(context.Background(), &model.DelegationRule{Delegator: "F002", Delegate: "F002", EndTime: 1})
+	if err == nil {
+		t.Error("delegating to oneself should return error")
+	}
+}
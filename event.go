@@ -0,0 +1,170 @@
+package kitten
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/logger"
+	"github.com/chapin666/kitten/pkg/metadata"
+)
+
+// EventType 事件类型
+type EventType string
+
+// 定义事件类型
+const (
+	EventFlowStarted         EventType = "flow_started"          // 流程已启动
+	EventNodeInstanceCreated EventType = "node_instance_created" // 节点实例已创建
+	EventNodeCompleted       EventType = "node_completed"        // 节点已完成
+	EventTaskAssigned        EventType = "task_assigned"         // 人工任务已分配给候选人
+	EventFlowEnded           EventType = "flow_ended"            // 流程已结束
+	EventFlowStopped         EventType = "flow_stopped"          // 流程已停止
+	EventTimerFired          EventType = "timer_fired"           // 节点定时已触发
+)
+
+// Event 引擎事件
+type Event struct {
+	Type         EventType           `json:"type"`          // 事件类型
+	FlowInstance *model.FlowInstance `json:"flow_instance"` // 流程实例
+	Node         *model.Node         `json:"node"`          // 节点(节点相关的事件)
+	NodeInstance *model.NodeInstance `json:"node_instance"` // 节点实例(节点相关的事件)
+	CandidateIDs []string            `json:"candidate_ids"` // 候选人(人工任务分配事件)
+	Operator     string              `json:"operator"`      // 操作人
+	Time         int64               `json:"time"`          // 事件时间戳
+	Metadata     *metadata.Metadata  `json:"metadata"`      // 触发事件的调用元数据
+}
+
+// Listener 事件监听函数
+type Listener func(ctx context.Context, event *Event) error
+
+type listenerItem struct {
+	listener Listener
+	types    map[EventType]bool
+}
+
+func (l *listenerItem) match(t EventType) bool {
+	return len(l.types) == 0 || l.types[t]
+}
+
+type listenerRegistry struct {
+	sync.RWMutex
+	syncListeners  []*listenerItem
+	asyncListeners []*listenerItem
+}
+
+func newListenerItem(listener Listener, types []EventType) *listenerItem {
+	item := &listenerItem{listener: listener, types: make(map[EventType]bool)}
+	for _, t := range types {
+		item.types[t] = true
+	}
+	return item
+}
+
+// AddListener 注册同步事件监听，types为空时监听所有事件
+// 同步监听在流程数据变更的事务中执行，返回错误时否决本次操作并回滚所有数据变更
+func (e *Engine) AddListener(listener Listener, types ...EventType) {
+	e.listeners.Lock()
+	defer e.listeners.Unlock()
+	e.listeners.syncListeners = append(e.listeners.syncListeners, newListenerItem(listener, types))
+}
+
+// AddAsyncListener 注册异步事件监听，types为空时监听所有事件
+// 异步监听在流程数据变更的事务提交后执行，事务回滚时不会收到事件，返回的错误仅记录日志
+func (e *Engine) AddAsyncListener(listener Listener, types ...EventType) {
+	e.listeners.Lock()
+	defer e.listeners.Unlock()
+	e.listeners.asyncListeners = append(e.listeners.asyncListeners, newListenerItem(listener, types))
+}
+
+type eventQueueKey struct{}
+
+// 事务中产生的事件，在事务提交后通知异步监听
+type eventQueue struct {
+	sync.Mutex
+	events []*Event
+}
+
+func (q *eventQueue) push(event *Event) {
+	q.Lock()
+	q.events = append(q.events, event)
+	q.Unlock()
+}
+
+// 在事务中执行函数，事务提交后通知异步监听
+// 上下文中已存在事件队列时由外层负责通知
+func (e *Engine) execTrans(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := ctx.Value(eventQueueKey{}).(*eventQueue); ok {
+		return e.flowSvc.ExecTrans(ctx, fn)
+	}
+
+	queue := new(eventQueue)
+	err := e.flowSvc.ExecTrans(context.WithValue(ctx, eventQueueKey{}, queue), fn)
+	if err != nil {
+		return err
+	}
+
+	e.publishAsync(queue.events...)
+	return nil
+}
+
+// 触发事件，依次执行同步监听，任一同步监听返回错误时终止
+func (e *Engine) fire(ctx context.Context, event *Event) error {
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+	if event.Metadata == nil {
+		event.Metadata = metadata.FromContext(ctx)
+	}
+
+	e.listeners.RLock()
+	listeners := e.listeners.syncListeners
+	e.listeners.RUnlock()
+
+	for _, item := range listeners {
+		if !item.match(event.Type) {
+			continue
+		}
+		if err := item.listener(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	if queue, ok := ctx.Value(eventQueueKey{}).(*eventQueue); ok {
+		queue.push(event)
+		return nil
+	}
+	e.publishAsync(event)
+	return nil
+}
+
+// 按事件顺序通知异步监听
+func (e *Engine) publishAsync(events ...*Event) {
+	e.listeners.RLock()
+	listeners := e.listeners.asyncListeners
+	e.listeners.RUnlock()
+
+	if len(listeners) == 0 || len(events) == 0 {
+		return
+	}
+
+	go func() {
+		for _, event := range events {
+			// 异步监听使用触发事件时的调用元数据(租户等)
+			ctx := metadata.NewContext(context.Background(), event.Metadata)
+			for _, item := range listeners {
+				if !item.match(event.Type) {
+					continue
+				}
+				if err := item.listener(ctx, event); err != nil {
+					fields := []logger.Field{logger.F("event_type", event.Type)}
+					if event.FlowInstance != nil {
+						fields = append(fields, logger.F(logger.FlowInstanceIDKey, event.FlowInstance.RecordID))
+					}
+					e.logError(ctx, "处理异步事件发生错误", err, fields...)
+				}
+			}
+		}
+	}()
+}
@@ -1,18 +1,18 @@
 package kitten
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"github.com/chapin666/kitten/pkg/expression"
 )
 
 // Execer 表达式执行器
 type Execer interface {
 	// 执行表达式返回布尔类型的值
-	ExecReturnBool(exp, params []byte) (bool, error)
+	ExecReturnBool(ctx context.Context, exp, params []byte) (bool, error)
 
 	// 执行表达式返回字符串切片类型的值
-	ExecReturnStringSlice(exp, params []byte) ([]string, error)
+	ExecReturnStringSlice(ctx context.Context, exp, params []byte) ([]string, error)
 }
 
 type execer struct {}
@@ -23,26 +23,22 @@ func NewQLangExecer() Execer {
 }
 
 
-func (*execer) ExecReturnBool(exp, params []byte) (bool, error) {
+func (*execer) ExecReturnBool(ctx context.Context, exp, params []byte) (bool, error) {
 	var m map[string]interface{}
 	err := json.Unmarshal(params, &m)
 	if err != nil {
 		return false, err
 	}
-	return expression.ExecParamBool(string(exp), m)
+	return expression.ExecParamBoolContext(ctx, string(exp), m)
 }
 
-func (*execer) ExecReturnStringSlice(exp, params []byte) ([]string, error) {
+func (*execer) ExecReturnStringSlice(ctx context.Context, exp, params []byte) ([]string, error) {
 	var m map[string]interface{}
 	err := json.Unmarshal(params, &m)
 	if err != nil {
 		return nil, err
 	}
-
-	fmt.Println(string(exp))
-	fmt.Println(m)
-
-	return expression.ExecParamSliceStr(string(exp), m)
+	return expression.ExecParamSliceStrContext(ctx, string(exp), m)
 }
 
 
@@ -0,0 +1,96 @@
+package kitten
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chapin666/kitten/pkg/identity"
+)
+
+// 候选人解析的节点属性名称
+// 上级及部门的属性值为launcher(流程发起人)或processor(上一节点处理人)
+const (
+	CandidateGroupsProperty       = "candidate_groups"        // 候选组(部署时由BPMN的candidateGroups解析，多个以逗号分隔)
+	CandidateManagerOfProperty    = "candidate_manager_of"    // 以指定人员的直属上级作为候选人
+	CandidateDepartmentOfProperty = "candidate_department_of" // 以指定人员所在部门的成员作为候选人
+)
+
+// IdentityProviderOption 设定身份提供者
+// 创建人工任务时通过身份提供者将候选组、上级及部门解析为候选人，发起流程时校验可发起的用户组
+func IdentityProviderOption(p identity.Provider) Option {
+	return func(o *engineOptions) {
+		o.identity = p
+	}
+}
+
+// 解析节点的候选组、上级及部门，与指派人表达式的候选人合并(去除重复)
+func (e *Engine) resolveCandidates(
+	ctx context.Context,
+	props map[string]string,
+	candidates []string,
+	launcher string,
+	processor string,
+) ([]string, error) {
+	groups := splitProperty(props[CandidateGroupsProperty])
+	managerOf := props[CandidateManagerOfProperty]
+	departmentOf := props[CandidateDepartmentOfProperty]
+	if len(groups) == 0 && managerOf == "" && departmentOf == "" {
+		return candidates, nil
+	}
+	if e.identity == nil {
+		return nil, errors.New("未设定身份提供者，无法解析节点的候选组")
+	}
+
+	var userOf = func(v string) string {
+		if v == "processor" {
+			return processor
+		}
+		return launcher
+	}
+
+	for _, g := range groups {
+		members, err := e.identity.GroupMembers(ctx, g)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, members...)
+	}
+
+	if managerOf != "" {
+		manager, err := identity.ManagerOf(ctx, e.identity, userOf(managerOf))
+		if err != nil {
+			return nil, err
+		}
+		if manager != "" {
+			candidates = append(candidates, manager)
+		}
+	}
+
+	if departmentOf != "" {
+		department, err := identity.DepartmentOf(ctx, e.identity, userOf(departmentOf))
+		if err != nil {
+			return nil, err
+		}
+		members, err := e.identity.DepartmentMembers(ctx, department)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, members...)
+	}
+
+	return uniqueStrings(candidates), nil
+}
+
+// 去除重复的字符串，保持原有顺序
+func uniqueStrings(items []string) []string {
+	exists := make(map[string]bool, len(items))
+	result := make([]string, 0, len(items))
+	for _, s := range items {
+		if s == "" || exists[s] {
+			continue
+		}
+		exists[s] = true
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,192 @@
+package kitten
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/logger"
+	"github.com/chapin666/kitten/pkg/retry"
+	"github.com/chapin666/kitten/pkg/util"
+)
+
+type jobExecutorOptions struct {
+	workers      int
+	batchSize    int
+	interval     time.Duration
+	lockDuration time.Duration
+	backoff      retry.Sleep
+}
+
+// JobExecutorOption 作业执行器配置
+type JobExecutorOption func(*jobExecutorOptions)
+
+// JobWorkersOption 设定并发执行作业的数量
+func JobWorkersOption(workers int) JobExecutorOption {
+	return func(o *jobExecutorOptions) {
+		o.workers = workers
+	}
+}
+
+// JobBatchSizeOption 设定每次获取的作业数量
+func JobBatchSizeOption(size int) JobExecutorOption {
+	return func(o *jobExecutorOptions) {
+		o.batchSize = size
+	}
+}
+
+// JobIntervalOption 设定获取作业的间隔
+func JobIntervalOption(interval time.Duration) JobExecutorOption {
+	return func(o *jobExecutorOptions) {
+		o.interval = interval
+	}
+}
+
+// JobLockDurationOption 设定作业的锁定时长，超过锁定时长未完成的作业可以被其他执行器重新获取
+func JobLockDurationOption(d time.Duration) JobExecutorOption {
+	return func(o *jobExecutorOptions) {
+		o.lockDuration = d
+	}
+}
+
+// JobBackoffOption 设定作业失败后的重试间隔(参数为已执行次数)
+func JobBackoffOption(backoff retry.Sleep) JobExecutorOption {
+	return func(o *jobExecutorOptions) {
+		o.backoff = backoff
+	}
+}
+
+// JobExecutor 异步作业执行器
+// 多个执行器(可以在不同的进程中)通过作业锁定共同执行作业，锁定过期的作业可以被重新获取
+type JobExecutor struct {
+	engine *Engine
+	owner  string
+	opts   *jobExecutorOptions
+}
+
+// NewJobExecutor 创建异步作业执行器
+func (e *Engine) NewJobExecutor(options ...JobExecutorOption) *JobExecutor {
+	opts := &jobExecutorOptions{
+		workers:      4,
+		batchSize:    100,
+		interval:     time.Second,
+		lockDuration: 5 * time.Minute,
+		backoff:      retry.Backoff(10*time.Second, 10*time.Minute),
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	return &JobExecutor{
+		engine: e,
+		owner:  util.UUID(),
+		opts:   opts,
+	}
+}
+
+// Run 定时获取并执行到期的作业，直到ctx结束
+func (x *JobExecutor) Run(ctx context.Context) {
+	ticker := time.NewTicker(x.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := x.ExecuteJobs(ctx); err != nil {
+				x.engine.logError(ctx, "执行异步作业发生错误", err)
+			}
+		}
+	}
+}
+
+// ExecuteJobs 获取并执行一批到期的作业，等待本批作业执行完成后返回
+func (x *JobExecutor) ExecuteJobs(ctx context.Context) error {
+	jobs, err := x.engine.flowSvc.AcquireJobs(ctx, x.owner, x.opts.lockDuration, x.opts.batchSize)
+	if err != nil {
+		return err
+	}
+
+	queue := make(chan *model.Job)
+	var wg sync.WaitGroup
+	for i := 0; i < x.opts.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				x.executeJob(ctx, job)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	return nil
+}
+
+// 执行作业，作业的流转与作业完成在同一事务中执行，失败时记录错误并按重试间隔重新执行
+// 先完成作业再流转，流转中的汇聚及结束检查不会把当前作业计为未完成的待办
+func (x *JobExecutor) executeJob(ctx context.Context, job *model.Job) {
+	ctx = restoreMetadataContext(ctx, job.Metadata, job.Flag)
+
+	err := x.engine.execTrans(ctx, func(ctx context.Context) error {
+		err := x.engine.flowSvc.DoneJob(ctx, job)
+		if err != nil {
+			return err
+		}
+		return x.engine.runJob(ctx, job)
+	})
+	if err == nil {
+		return
+	}
+
+	fields := []logger.Field{
+		logger.F("job_id", job.RecordID),
+		logger.F(logger.FlowInstanceIDKey, job.FlowInstanceID),
+		logger.F(logger.NodeInstanceIDKey, job.NodeInstanceID),
+	}
+	x.engine.logError(ctx, "执行异步作业发生错误", err, fields...)
+	failed, ferr := x.engine.flowSvc.FailJob(ctx, job, err, x.opts.backoff(int(job.Attempts+1)))
+	if ferr != nil {
+		x.engine.logError(ctx, "记录异步作业失败发生错误", ferr, fields...)
+	} else if failed {
+		logger.Warn(ctx, x.engine.logger, "异步作业已超过重试次数", fields...)
+	}
+}
+
+// 从作业的节点实例继续流转
+func (e *Engine) runJob(ctx context.Context, job *model.Job) error {
+	// 与其他流转一样锁定流程实例
+	err := e.flowSvc.LockFlowInstance(ctx, job.FlowInstanceID)
+	if err != nil {
+		return err
+	}
+
+	nr, err := new(NodeRouter).Init(ctx, e, job.NodeInstanceID, []byte(job.Input))
+	if err != nil {
+		return err
+	}
+
+	switch job.TypeCode {
+	case model.JobTypeAsyncBefore:
+		// 恢复等待异步作业的节点实例
+		if nr.nodeInstance.Status == 5 {
+			err = e.flowSvc.UpdateNodeInstanceStatus(ctx, nr.nodeInstance, 1)
+			if err != nil {
+				return err
+			}
+		}
+		nr.resumed = true
+		return nr.Next(job.Processor)
+	case model.JobTypeAsyncAfter:
+		return nr.leave(job.Processor)
+	}
+	return errors.New("无效的作业类型")
+}
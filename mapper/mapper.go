@@ -21,4 +21,16 @@ func FlowDBMap(dbInstance *db.DB) {
 	dbInstance.AddTableWithName(model.FieldProperty{}, model.FieldPropertyTableName)
 	dbInstance.AddTableWithName(model.FieldValidation{}, model.FieldValidationTableName)
 	dbInstance.AddTableWithName(model.NodeProperty{}, model.NodePropertyTableName)
+	dbInstance.AddTableWithName(model.InstanceHistory{}, model.InstanceHistoryTableName)
+	dbInstance.AddTableWithName(model.FlowVariable{}, model.FlowVariableTableName).
+		SetUniqueTogether("flow_instance_id", "scope", "name")
+	dbInstance.AddTableWithName(model.Idempotency{}, model.IdempotencyTableName).
+		SetUniqueTogether("tenant_id", "idempotency_key", "operation")
+	dbInstance.AddTableWithName(model.Job{}, model.JobTableName)
+	dbInstance.AddTableWithName(model.Incident{}, model.IncidentTableName)
+	dbInstance.AddTableWithName(model.Outbox{}, model.OutboxTableName)
+	dbInstance.AddTableWithName(model.FlowProperty{}, model.FlowPropertyTableName)
+	dbInstance.AddTableWithName(model.DeadLetter{}, model.DeadLetterTableName)
+	dbInstance.AddTableWithName(model.ExpressionTrace{}, model.ExpressionTraceTableName)
+	dbInstance.AddTableWithName(model.DelegationRule{}, model.DelegationRuleTableName)
 }
@@ -0,0 +1,125 @@
+package kitten
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chapin666/kitten/pkg/metrics"
+)
+
+// 流程及节点的编号缓存(内码->编号)，流程和节点发布后编号不再变化
+type codeCache struct {
+	sync.Map
+}
+
+// 注册指标收集的事件监听，指标在流程数据变更提交后记录
+func (e *Engine) enableMetrics() {
+	e.AddAsyncListener(e.collectMetrics, EventFlowStarted, EventFlowEnded, EventFlowStopped, EventNodeCompleted)
+}
+
+// 根据事件记录指标
+func (e *Engine) collectMetrics(ctx context.Context, event *Event) error {
+	if event.FlowInstance == nil {
+		return nil
+	}
+
+	flowCode, err := e.getFlowCode(ctx, event.FlowInstance.FlowID)
+	if err != nil {
+		return err
+	}
+
+	switch event.Type {
+	case EventFlowStarted:
+		e.metrics.FlowStarted(flowCode)
+	case EventFlowEnded:
+		e.metrics.FlowCompleted(flowCode)
+	case EventFlowStopped:
+		e.metrics.FlowStopped(flowCode)
+	case EventNodeCompleted:
+		if event.NodeInstance == nil {
+			return nil
+		}
+		nodeCode, err := e.getNodeCode(ctx, event.NodeInstance.NodeID)
+		if err != nil {
+			return err
+		}
+		dwell := time.Duration(event.Time-event.NodeInstance.Created) * time.Second
+		e.metrics.NodeCompleted(flowCode, nodeCode, dwell)
+	}
+	return nil
+}
+
+func (e *Engine) getFlowCode(ctx context.Context, flowID string) (string, error) {
+	if v, ok := e.codes.Load(flowID); ok {
+		return v.(string), nil
+	}
+
+	flow, err := e.flowSvc.GetFlow(ctx, flowID)
+	if err != nil {
+		return "", err
+	} else if flow == nil {
+		return "", ErrNotFound
+	}
+	e.codes.Store(flowID, flow.Code)
+	return flow.Code, nil
+}
+
+func (e *Engine) getNodeCode(ctx context.Context, nodeID string) (string, error) {
+	if v, ok := e.codes.Load(nodeID); ok {
+		return v.(string), nil
+	}
+
+	node, err := e.flowSvc.GetNode(ctx, nodeID)
+	if err != nil {
+		return "", err
+	} else if node == nil {
+		return "", ErrNotFound
+	}
+	e.codes.Store(nodeID, node.Code)
+	return node.Code, nil
+}
+
+// RefreshMetrics 刷新需要查询数据库的指标(节点待办数量、已到期未处理的节点定时数量)
+// 可以在指标采集前调用，或通过RunMetrics定时刷新
+func (e *Engine) RefreshMetrics(ctx context.Context) error {
+	counts, err := e.flowSvc.QueryNodeTodoCounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*metrics.TodoCount, len(counts))
+	for i, c := range counts {
+		items[i] = &metrics.TodoCount{
+			FlowCode: c.FlowCode,
+			NodeCode: c.NodeCode,
+			Count:    c.Count,
+		}
+	}
+	e.metrics.SetTodoCounts(items)
+
+	backlog, err := e.flowSvc.CountExpiredNodeTimings(ctx)
+	if err != nil {
+		return err
+	}
+	e.metrics.SetTimerBacklog(backlog)
+	return nil
+}
+
+// RunMetrics 定时刷新需要查询数据库的指标，直到ctx结束
+// interval 刷新间隔
+func (e *Engine) RunMetrics(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.RefreshMetrics(ctx); err != nil {
+				e.logError(ctx, "刷新指标发生错误", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package model
+
+// CandidateStat 候选人的任务统计(用于指派策略)
+type CandidateStat struct {
+	CandidateID string `db:"candidate_id" structs:"candidate_id" json:"candidate_id"` // 候选人ID
+	Value       int64  `db:"value" structs:"value" json:"value"`                      // 统计值(待办数量或最近指派的候选记录ID)
+}
@@ -16,4 +16,14 @@ const (
 	FieldOptionTableName     = "f_field_option"     // 流程表单字段选项
 	FieldPropertyTableName   = "f_field_property"   // 流程表单字段属性
 	FieldValidationTableName = "f_field_validation" // 流程表单字段校验
-)
\ No newline at end of file
+	InstanceHistoryTableName = "f_instance_history" // 实例历史
+	FlowVariableTableName    = "f_flow_variable"    // 流程实例变量
+	IdempotencyTableName     = "f_idempotency"      // 幂等记录
+	JobTableName             = "f_job"              // 异步作业
+	IncidentTableName        = "f_incident"         // 流程事件
+	OutboxTableName          = "f_outbox"           // 事件发件箱
+	FlowPropertyTableName    = "f_flow_property"    // 流程属性
+	DeadLetterTableName      = "f_dead_letter"      // 投递失败的通知
+	ExpressionTraceTableName = "f_expression_trace" // 表达式执行记录
+	DelegationRuleTableName  = "f_delegation_rule"  // 委托规则
+)
@@ -0,0 +1,15 @@
+package model
+
+// DeadLetter 投递失败的通知
+type DeadLetter struct {
+	ID           int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                    // 唯一标识(自增ID)
+	RecordID     string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                // 记录内码(uuid)
+	URL          string `db:"url,size:65535" structs:"url" json:"url"`                               // 通知地址
+	EventType    string `db:"event_type,size:50" structs:"event_type" json:"event_type"`             // 事件类型
+	DeliveryID   string `db:"delivery_id,size:36" structs:"delivery_id" json:"delivery_id"`          // 通知ID
+	Payload      string `db:"payload,size:16777215" structs:"payload" json:"payload"`                // 通知内容
+	Attempts     int64  `db:"attempts" structs:"attempts" json:"attempts"`                           // 投递次数
+	ErrorMessage string `db:"error_message,size:65535" structs:"error_message" json:"error_message"` // 最后一次的错误信息
+	Created      int64  `db:"created" structs:"created" json:"created"`                              // 创建时间戳
+	Deleted      int64  `db:"deleted" structs:"deleted" json:"deleted"`                              // 删除时间戳
+}
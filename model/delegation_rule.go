@@ -0,0 +1,17 @@
+package model
+
+// DelegationRule 委托规则(委托人在有效期内的任务转交给受托人处理)
+type DelegationRule struct {
+	ID        int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`     // 唯一标识(自增ID)
+	RecordID  string `db:"record_id,size:36" structs:"record_id" json:"record_id"` // 记录内码(uuid)
+	TenantID  string `db:"tenant_id,size:64" structs:"tenant_id" json:"tenant_id"` // 租户
+	Delegator string `db:"delegator,size:36" structs:"delegator" json:"delegator"` // 委托人
+	Delegate  string `db:"delegate,size:36" structs:"delegate" json:"delegate"`    // 受托人
+	FlowCode  string `db:"flow_code,size:50" structs:"flow_code" json:"flow_code"` // 流程编号(为空时适用于所有流程)
+	StartTime int64  `db:"start_time" structs:"start_time" json:"start_time"`      // 开始时间戳
+	EndTime   int64  `db:"end_time" structs:"end_time" json:"end_time"`            // 结束时间戳
+	Memo      string `db:"memo,size:255" structs:"memo" json:"memo"`               // 备注
+	Created   int64  `db:"created" structs:"created" json:"created"`               // 创建时间戳
+	Updated   int64  `db:"updated" structs:"updated" json:"updated"`               // 更新时间戳
+	Deleted   int64  `db:"deleted" structs:"deleted" json:"deleted"`               // 删除时间戳
+}
@@ -0,0 +1,24 @@
+package model
+
+// 定义表达式类型
+const (
+	ExpressionKindCondition  = "condition"  // 路由条件表达式
+	ExpressionKindAssignment = "assignment" // 指派人表达式
+)
+
+// ExpressionTrace 表达式执行记录
+type ExpressionTrace struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	NodeInstanceID string `db:"node_instance_id,size:36" structs:"node_instance_id" json:"node_instance_id"` // 执行表达式的节点实例内码
+	TargetNodeID   string `db:"target_node_id,size:36" structs:"target_node_id" json:"target_node_id"`       // 路由的目标节点内码
+	Kind           string `db:"kind,size:50" structs:"kind" json:"kind"`                                     // 表达式类型
+	Expression     string `db:"expression,size:65535" structs:"expression" json:"expression"`                // 表达式
+	Input          string `db:"input,size:16777215" structs:"input" json:"input"`                            // 表达式的输入数据快照
+	Result         string `db:"result,size:65535" structs:"result" json:"result"`                            // 执行结果(json)
+	Error          string `db:"error,size:65535" structs:"error" json:"error"`                               // 错误信息
+	Duration       int64  `db:"duration" structs:"duration" json:"duration"`                                 // 执行耗时(微秒)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
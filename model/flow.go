@@ -4,11 +4,12 @@ package model
 type Flow struct {
 	ID       int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`     // 唯一标识(自增ID)
 	RecordID string `db:"record_id,size:36" structs:"record_id" json:"record_id"` // 记录内码(uuid)
+	TenantID string `db:"tenant_id,size:64" structs:"tenant_id" json:"tenant_id"` // 租户
 	Code     string `db:"code,size:50" structs:"code" json:"code"`                // 流程编号
 	Name     string `db:"name,size:50" structs:"name" json:"name"`                // 流程名称
 	Version  int64  `db:"version" structs:"version" json:"version"`               // 版本号
 	TypeCode string `db:"type_code,size:50" structs:"type_code" json:"type_code"` // 流程类型编号
-	XML      string `db:"xml,size:1024" structs:"xml" json:"xml"`                 // XML数据
+	XML      string `db:"xml,size:16777215" structs:"xml" json:"xml"`             // XML数据
 	Memo     string `db:"memo,size:255" structs:"memo" json:"memo"`               // 流程备注
 	Flag     int64  `db:"flag" structs:"flag" json:"flag"`                        // 流程标志(1:主流程 2:子流程)
 	ParentID string `db:"parent_id,size:36" structs:"parent_id" json:"parent_id"` // 父级流程内码
@@ -2,15 +2,18 @@ package model
 
 // FlowTodoResult 流程待办结果
 type FlowTodoResult struct {
-	RecordID       string  `db:"record_id" structs:"record_id" json:"record_id"`                      // 节点实例内码
-	FlowInstanceID string  `db:"flow_instance_id" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
-	FlowName       string  `db:"flow_name" structs:"flow_name" json:"flow_name"`                      // 流程名称
-	NodeID         string  `db:"node_id" structs:"node_id" json:"node_id"`                            // 节点内码
-	NodeCode       string  `db:"node_code" structs:"node_code" json:"node_code"`                      // 节点编号
-	NodeName       string  `db:"node_name" structs:"node_name" json:"node_name"`                      // 节点名称
-	InputData      string  `db:"input_data" structs:"input_data" json:"input_data"`                   // 输入数据
-	Launcher       string  `db:"launcher" structs:"launcher" json:"launcher"`                         // 发起人
-	LaunchTime     int64   `db:"launch_time" structs:"launch_time" json:"launch_time"`                // 发起时间
-	FormType       *string `db:"form_type" structs:"form_type" json:"form_type"`                      // 表单类型
-	FormData       *string `db:"form_data" structs:"form_data" json:"form_data"`                      // 表单数据
+	RecordID         string  `db:"record_id" structs:"record_id" json:"record_id"`                         // 节点实例内码
+	FlowInstanceID   string  `db:"flow_instance_id" structs:"flow_instance_id" json:"flow_instance_id"`    // 流程实例内码
+	FlowName         string  `db:"flow_name" structs:"flow_name" json:"flow_name"`                         // 流程名称
+	NodeID           string  `db:"node_id" structs:"node_id" json:"node_id"`                               // 节点内码
+	NodeCode         string  `db:"node_code" structs:"node_code" json:"node_code"`                         // 节点编号
+	NodeName         string  `db:"node_name" structs:"node_name" json:"node_name"`                         // 节点名称
+	InputData        string  `db:"input_data" structs:"input_data" json:"input_data"`                      // 输入数据
+	Assignee         string  `db:"assignee" structs:"assignee" json:"assignee"`                            // 办理人
+	Owner            string  `db:"owner" structs:"owner" json:"owner"`                                     // 任务所有人(委派人)
+	OriginalAssignee string  `db:"original_assignee" structs:"original_assignee" json:"original_assignee"` // 原处理人(按委托规则转交时为委托人)
+	Launcher         string  `db:"launcher" structs:"launcher" json:"launcher"`                            // 发起人
+	LaunchTime       int64   `db:"launch_time" structs:"launch_time" json:"launch_time"`                   // 发起时间
+	FormType         *string `db:"form_type" structs:"form_type" json:"form_type"`                         // 表单类型
+	FormData         *string `db:"form_data" structs:"form_data" json:"form_data"`                         // 表单数据
 }
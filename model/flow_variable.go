@@ -0,0 +1,24 @@
+package model
+
+// 定义变量类型
+const (
+	VariableTypeString = "string" // 字符串
+	VariableTypeNumber = "number" // 数值
+	VariableTypeBool   = "bool"   // 布尔
+	VariableTypeJSON   = "json"   // JSON对象或数组
+	VariableTypeNull   = "null"   // 空值
+)
+
+// FlowVariable 流程实例变量
+type FlowVariable struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	Scope          string `db:"scope,size:36" structs:"scope" json:"scope"`                                  // 作用域(空:流程实例 其他:节点实例内码)
+	Name           string `db:"name,size:100" structs:"name" json:"name"`                                    // 变量名称
+	TypeCode       string `db:"type_code,size:20" structs:"type_code" json:"type_code"`                      // 变量类型(string number bool json null)
+	Value          string `db:"value,size:16777215" structs:"value" json:"value"`                            // 变量值(JSON编码)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
@@ -8,7 +8,7 @@ type Form struct {
 	Code     string `db:"code,size:50" structs:"code" json:"code"`                // 表单编号(唯一)
 	Name     string `db:"name,size:50" structs:"name" json:"name"`                // 表单名称
 	TypeCode string `db:"type_code,size:50" structs:"type_code" json:"type_code"` // 表单类型(URL:表单链接路径 META:表单元数据)
-	Data     string `db:"data,size:1024" structs:"data" json:"data"`              // 表单数据
+	Data     string `db:"data,size:16777215" structs:"data" json:"data"`          // 表单数据
 	Created  int64  `db:"created" structs:"created" json:"created"`               // 创建时间戳
 	Updated  int64  `db:"updated" structs:"updated" json:"updated"`               // 更新时间戳
 	Deleted  int64  `db:"deleted" structs:"deleted" json:"deleted"`               // 删除时间戳
@@ -11,13 +11,13 @@ type NextNode struct {
 
 // HandleResult 处理结果
 type HandleResult struct {
-	IsEnd        bool          `json:"is_end"`        // 是否结束
-	NextNodes    []*NextNode   `json:"next_nodes"`    // 下一处理节点
-	FlowInstance *FlowInstance `json:"flow_instance"` // 流程实例
+	IsEnd        bool               `json:"is_end"`        // 是否结束
+	NextNodes    []*NextNode        `json:"next_nodes"`    // 下一处理节点
+	FlowInstance *FlowInstance      `json:"flow_instance"` // 流程实例
+	Traces       []*ExpressionTrace `json:"traces"`        // 本次流转执行的表达式记录
 }
 
 func (r *HandleResult) String() string {
 	b, _ := json.Marshal(r)
 	return string(b)
 }
-
@@ -0,0 +1,21 @@
+package model
+
+// 定义幂等操作类型
+const (
+	IdempotencyOperationStart   = "start"    // 启动流程
+	IdempotencyOperationHandle  = "handle"   // 处理流程节点
+	IdempotencyOperationAddSign = "add_sign" // 加签
+)
+
+// Idempotency 幂等记录
+type Idempotency struct {
+	ID          int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                        // 唯一标识(自增ID)
+	RecordID    string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                    // 记录内码(uuid)
+	TenantID    string `db:"tenant_id,size:64" structs:"tenant_id" json:"tenant_id"`                    // 租户
+	Key         string `db:"idempotency_key,size:128" structs:"idempotency_key" json:"idempotency_key"` // 幂等键
+	Operation   string `db:"operation,size:50" structs:"operation" json:"operation"`                    // 操作类型
+	Fingerprint string `db:"fingerprint,size:64" structs:"fingerprint" json:"fingerprint"`              // 请求指纹(操作对象、处理人及输入数据的摘要)
+	Result      string `db:"result,size:16777215" structs:"result" json:"result"`                       // 处理结果
+	Created     int64  `db:"created" structs:"created" json:"created"`                                  // 创建时间戳
+	Deleted     int64  `db:"deleted" structs:"deleted" json:"deleted"`                                  // 删除时间戳
+}
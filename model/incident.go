@@ -0,0 +1,24 @@
+package model
+
+// 定义事件类型
+const (
+	IncidentTypeFailedJob = "failed_job" // 异步作业执行失败
+)
+
+// Incident 流程事件(自动执行的步骤失败后需要人工干预的事件)
+type Incident struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	NodeInstanceID string `db:"node_instance_id,size:36" structs:"node_instance_id" json:"node_instance_id"` // 节点实例内码
+	JobID          string `db:"job_id,size:36" structs:"job_id" json:"job_id"`                               // 异步作业内码
+	TypeCode       string `db:"type_code,size:20" structs:"type_code" json:"type_code"`                      // 事件类型
+	ErrorMessage   string `db:"error_message,size:65535" structs:"error_message" json:"error_message"`       // 错误信息
+	Stack          string `db:"stack,size:16777215" structs:"stack" json:"stack"`                            // 错误堆栈
+	RetryCount     int64  `db:"retry_count" structs:"retry_count" json:"retry_count"`                        // 已执行次数
+	Operator       string `db:"operator,size:36" structs:"operator" json:"operator"`                         // 处理人(重试或解决事件的操作人)
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 事件状态(1:未处理 2:已重试 3:已解决)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
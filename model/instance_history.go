@@ -0,0 +1,46 @@
+package model
+
+// 定义实例历史操作类型
+const (
+	HistoryActionStart           = "start"            // 发起流程
+	HistoryActionView            = "view"             // 查看节点实例
+	HistoryActionComplete        = "complete"         // 完成节点实例
+	HistoryActionRoute           = "route"            // 路由决策
+	HistoryActionEnd             = "end"              // 结束流程
+	HistoryActionClaim           = "claim"            // 签收
+	HistoryActionUnclaim         = "unclaim"          // 取消签收
+	HistoryActionTransfer        = "transfer"         // 转办
+	HistoryActionDelegate        = "delegate"         // 委派
+	HistoryActionResolve         = "resolve"          // 解决委派
+	HistoryActionAddSignBefore   = "add_sign_before"  // 前加签
+	HistoryActionAddSignAfter    = "add_sign_after"   // 后加签
+	HistoryActionSuspend         = "suspend"          // 暂停流程
+	HistoryActionResume          = "resume"           // 恢复流程
+	HistoryActionStop            = "stop"             // 停止流程
+	HistoryActionTimer           = "timer"            // 定时触发
+	HistoryActionRetryIncident   = "retry_incident"   // 重试事件
+	HistoryActionResolveIncident = "resolve_incident" // 解决事件
+)
+
+// InstanceHistory 实例历史
+type InstanceHistory struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	NodeInstanceID string `db:"node_instance_id,size:36" structs:"node_instance_id" json:"node_instance_id"` // 节点实例内码
+	Action         string `db:"action,size:50" structs:"action" json:"action"`                               // 操作类型
+	Operator       string `db:"operator,size:36" structs:"operator" json:"operator"`                         // 操作人
+	Target         string `db:"target,size:36" structs:"target" json:"target"`                               // 目标人(转办、委派的接收人)
+	Data           string `db:"data,size:16777215" structs:"data" json:"data"`                               // 操作数据
+	Metadata       string `db:"metadata,size:65535" structs:"metadata" json:"metadata"`                      // 调用元数据(JSON)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
+
+// RouteDecision 路由决策(路由操作的操作数据)
+type RouteDecision struct {
+	RouterID     string `json:"router_id"`      // 节点路由内码
+	TargetNodeID string `json:"target_node_id"` // 目标节点内码
+	Expression   string `json:"expression"`     // 条件表达式
+	Result       bool   `json:"result"`         // 条件结果(无条件表达式时为true)
+}
@@ -0,0 +1,30 @@
+package model
+
+// 定义作业类型
+const (
+	JobTypeAsyncBefore = "async_before" // 进入节点前异步执行
+	JobTypeAsyncAfter  = "async_after"  // 完成节点后异步流转
+)
+
+// Job 异步作业
+type Job struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	NodeInstanceID string `db:"node_instance_id,size:36" structs:"node_instance_id" json:"node_instance_id"` // 节点实例内码
+	TypeCode       string `db:"type_code,size:20" structs:"type_code" json:"type_code"`                      // 作业类型
+	Processor      string `db:"processor,size:36" structs:"processor" json:"processor"`                      // 处理人
+	Input          string `db:"input,size:16777215" structs:"input" json:"input"`                            // 输入数据
+	Flag           string `db:"flag,size:255" structs:"flag" json:"flag"`                                    // 标志
+	Metadata       string `db:"metadata,size:65535" structs:"metadata" json:"metadata"`                      // 调用元数据(JSON)
+	Retries        int64  `db:"retries" structs:"retries" json:"retries"`                                    // 剩余重试次数
+	Attempts       int64  `db:"attempts" structs:"attempts" json:"attempts"`                                 // 已执行次数
+	DueAt          int64  `db:"due_at" structs:"due_at" json:"due_at"`                                       // 计划执行时间
+	LockOwner      string `db:"lock_owner,size:64" structs:"lock_owner" json:"lock_owner"`                   // 锁定的执行器
+	LockExpiredAt  int64  `db:"lock_expired_at" structs:"lock_expired_at" json:"lock_expired_at"`            // 锁定过期时间
+	ErrorMessage   string `db:"error_message,size:65535" structs:"error_message" json:"error_message"`       // 最近一次的错误信息
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 作业状态(1:待执行 2:已完成 3:执行失败)
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
@@ -1,16 +1,30 @@
 package model
 
+// 定义加签类型
+const (
+	AddSignTypeBefore int64 = 1 // 前加签
+	AddSignTypeAfter  int64 = 2 // 后加签
+)
+
 // NodeInstance 节点实例表
 type NodeInstance struct {
 	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
 	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	TenantID       string `db:"tenant_id,size:64" structs:"tenant_id" json:"tenant_id"`                      // 租户
 	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
 	NodeID         string `db:"node_id,size:36" structs:"node_id" json:"node_id"`                            // 节点内码
 	Processor      string `db:"processor,size:36" structs:"processor" json:"processor"`                      // 处理人
 	ProcessTime    int64  `db:"process_time" structs:"process_time" json:"process_time"`                     // 处理时间(秒时间戳)
-	InputData      string `db:"input_data,size:1024" structs:"input_data" json:"input_data"`                 // 输入数据
-	OutData        string `db:"out_data,size:1024" structs:"out_data" json:"out_data"`                       // 输出数据
-	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 处理状态(1:待处理 2:已完成)
+	InputData      string `db:"input_data,size:16777215" structs:"input_data" json:"input_data"`             // 输入数据
+	OutData        string `db:"out_data,size:16777215" structs:"out_data" json:"out_data"`                   // 输出数据
+	Assignee       string `db:"assignee,size:36" structs:"assignee" json:"assignee"`                         // 办理人(签收、转办或委派后的唯一处理人)
+	Owner          string `db:"owner,size:36" structs:"owner" json:"owner"`                                  // 任务所有人(委派时记录委派人)
+	DelegateStatus int64  `db:"delegate_status" structs:"delegate_status" json:"delegate_status"`            // 委派状态(0:未委派 1:委派中 2:已解决)
+	ParentID       string `db:"parent_id,size:36" structs:"parent_id" json:"parent_id"`                      // 加签来源节点实例内码
+	AddSignType    int64  `db:"add_sign_type" structs:"add_sign_type" json:"add_sign_type"`                  // 加签类型(0:非加签 1:前加签 2:后加签)
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 处理状态(1:待处理 2:已完成 3:等待加签 4:已关闭 5:等待异步作业)
+	Metadata       string `db:"metadata,size:65535" structs:"metadata" json:"metadata"`                      // 调用元数据(JSON)
+	Version        int64  `db:"version" structs:"version" json:"version"`                                    // 数据版本(乐观锁)
 	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
 	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
 	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
@@ -2,10 +2,11 @@ package model
 
 // NodeOperating 节点操作
 type NodeOperating struct {
-	NodeGroup       []*Node
-	RouterGroup     []*NodeRouter
-	AssignmentGroup []*NodeAssignment
-	PropertyGroup   []*NodeProperty
+	NodeGroup         []*Node
+	RouterGroup       []*NodeRouter
+	AssignmentGroup   []*NodeAssignment
+	PropertyGroup     []*NodeProperty
+	FlowPropertyGroup []*FlowProperty // 流程属性
 }
 
 // All 获取所有节点操作的组
@@ -24,6 +25,9 @@ func (a *NodeOperating) All() []interface{} {
 	for _, item := range a.PropertyGroup {
 		group = append(group, item)
 	}
+	for _, item := range a.FlowPropertyGroup {
+		group = append(group, item)
+	}
 
 	return group
-}
\ No newline at end of file
+}
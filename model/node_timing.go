@@ -6,8 +6,9 @@ type NodeTiming struct {
 	NodeInstanceID string `db:"node_instance_id" structs:"node_instance_id" json:"node_instance_id"` // 节点实例ID
 	Flag           string `db:"flag" structs:"flag" json:"flag"`                                     // 标志
 	Processor      string `db:"processor,size:36" structs:"processor" json:"processor"`              // 处理人
-	Input          string `db:"input,size:1024" structs:"input" json:"input"`                        // 输入数据
+	Input          string `db:"input,size:16777215" structs:"input" json:"input"`                    // 输入数据
+	Metadata       string `db:"metadata,size:65535" structs:"metadata" json:"metadata"`              // 调用元数据(JSON)
 	ExpiredAt      int64  `db:"expired_at" structs:"expired_at" json:"expired_at"`                   // 过期时间戳
 	Created        int64  `db:"created" structs:"created" json:"created"`                            // 创建时间戳
 	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                            // 删除时间戳
-}
\ No newline at end of file
+}
@@ -0,0 +1,8 @@
+package model
+
+// NodeTodoCount 节点待办数量
+type NodeTodoCount struct {
+	FlowCode string `db:"flow_code" structs:"flow_code" json:"flow_code"` // 流程编号
+	NodeCode string `db:"node_code" structs:"node_code" json:"node_code"` // 节点编号
+	Count    int64  `db:"count" structs:"count" json:"count"`             // 待办数量
+}
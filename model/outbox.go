@@ -0,0 +1,20 @@
+package model
+
+// Outbox 事件发件箱(与流程数据变更在同一事务中保存，由中继投递)
+type Outbox struct {
+	ID             int64  `db:"id,primarykey,autoincrement" structs:"id" json:"id"`                          // 唯一标识(自增ID)
+	RecordID       string `db:"record_id,size:36" structs:"record_id" json:"record_id"`                      // 记录内码(uuid)
+	EventType      string `db:"event_type,size:50" structs:"event_type" json:"event_type"`                   // 事件类型
+	FlowInstanceID string `db:"flow_instance_id,size:36" structs:"flow_instance_id" json:"flow_instance_id"` // 流程实例内码
+	Payload        string `db:"payload,size:16777215" structs:"payload" json:"payload"`                      // 事件内容
+	Attempts       int64  `db:"attempts" structs:"attempts" json:"attempts"`                                 // 已投递次数
+	NextAttemptAt  int64  `db:"next_attempt_at" structs:"next_attempt_at" json:"next_attempt_at"`            // 下次投递时间
+	LockOwner      string `db:"lock_owner,size:64" structs:"lock_owner" json:"lock_owner"`                   // 锁定的中继
+	LockExpiredAt  int64  `db:"lock_expired_at" structs:"lock_expired_at" json:"lock_expired_at"`            // 锁定过期时间
+	ErrorMessage   string `db:"error_message,size:65535" structs:"error_message" json:"error_message"`       // 最近一次的错误信息
+	Status         int64  `db:"status" structs:"status" json:"status"`                                       // 投递状态(1:待投递 2:已投递)
+	DeliveredAt    int64  `db:"delivered_at" structs:"delivered_at" json:"delivered_at"`                     // 投递时间
+	Created        int64  `db:"created" structs:"created" json:"created"`                                    // 创建时间戳
+	Updated        int64  `db:"updated" structs:"updated" json:"updated"`                                    // 更新时间戳
+	Deleted        int64  `db:"deleted" structs:"deleted" json:"deleted"`                                    // 删除时间戳
+}
@@ -4,25 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
+
 	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/db"
+	"github.com/chapin666/kitten/pkg/logger"
+	"github.com/chapin666/kitten/pkg/metadata"
+	"github.com/chapin666/kitten/pkg/tracing"
 	"github.com/chapin666/kitten/pkg/types"
+	"github.com/chapin666/kitten/pkg/util"
 )
 
 // 定义错误
 var (
-	ErrNotFound = errors.New("未找到流程相关的信息")
+	ErrNotFound            = errors.New("未找到流程相关的信息")
+	ErrIdempotencyMismatch = errors.New("幂等键已被其他请求使用")
 )
 
+// ConflictError 并发冲突错误，节点实例或流程实例已被其他请求修改(例如多人同时处理同一节点)
+type ConflictError = db.ConflictError
+
+// IsConflict 检查错误是否为并发冲突错误，调用方可以刷新数据后重试
+func IsConflict(err error) bool {
+	return db.IsConflict(err)
+}
+
 // NextNodeHandle 定义下一节点处理函数
 type NextNodeHandle func(*model.Node, *model.NodeInstance, []*model.NodeCandidate)
 
 // EndHandle 定义流程结束处理函数
 type EndHandle func(*model.FlowInstance)
 
+// TraceHandle 定义表达式执行记录处理函数
+type TraceHandle func(*model.ExpressionTrace)
+
 type nodeRouterOptions struct {
 	autoStart  bool
 	onNextNode NextNodeHandle
 	onFlowEnd  EndHandle
+	onTrace    TraceHandle
 }
 
 // NodeRouterOption 节点路由配置
@@ -42,6 +62,13 @@ func OnFlowEndOption(fn EndHandle) NodeRouterOption {
 	}
 }
 
+// OnTraceOption 注册表达式执行记录事件
+func OnTraceOption(fn TraceHandle) NodeRouterOption {
+	return func(o *nodeRouterOptions) {
+		o.onTrace = fn
+	}
+}
+
 // NodeRouter 节点路由
 type NodeRouter struct {
 	ctx          context.Context
@@ -52,7 +79,9 @@ type NodeRouter struct {
 	opts         *nodeRouterOptions
 	flowInstance *model.FlowInstance
 	nodeInstance *model.NodeInstance
+	vars         map[string]interface{}
 	stop         bool
+	resumed      bool // 由异步作业恢复进入节点
 }
 
 // Init 初始化节点路由
@@ -76,7 +105,7 @@ func (r *NodeRouter) Init(
 	r.engine = engine
 
 	// nodeInstance
-	nodeInstance, err := r.engine.flowSvc.GetNodeInstance(nodeInstanceID)
+	nodeInstance, err := r.engine.flowSvc.GetNodeInstance(ctx, nodeInstanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +115,7 @@ func (r *NodeRouter) Init(
 	r.nodeInstance = nodeInstance
 
 	// flowInstance
-	flowInstance, err := r.engine.flowSvc.GetFlowInstance(nodeInstance.FlowInstanceID)
+	flowInstance, err := r.engine.flowSvc.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,7 +125,7 @@ func (r *NodeRouter) Init(
 	r.flowInstance = flowInstance
 
 	// 获取node
-	node, err := r.engine.flowSvc.GetNode(nodeInstance.NodeID)
+	node, err := r.engine.flowSvc.GetNode(ctx, nodeInstance.NodeID)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +135,13 @@ func (r *NodeRouter) Init(
 	}
 	r.node = node
 
+	// 流程实例变量(节点级别变量覆盖流程实例级别的同名变量)
+	vars, err := r.engine.flowSvc.GetVariables(ctx, flowInstance.RecordID, "", nodeInstance.RecordID)
+	if err != nil {
+		return nil, err
+	}
+	r.vars = vars
+
 	return r, nil
 }
 
@@ -116,25 +152,62 @@ func (r *NodeRouter) GetFlowInstance() *model.FlowInstance {
 
 // Next 流向下一节点
 func (r *NodeRouter) Next(processor string) error {
+	ctx, span := tracing.Start(r.ctx, "kitten.NodeRouter.Next",
+		tracing.FlowInstanceIDKey.String(r.flowInstance.RecordID),
+		tracing.NodeCodeKey.String(r.node.Code),
+		tracing.NodeTypeKey.String(r.node.TypeCode),
+		tracing.NodeInstanceIDKey.String(r.nodeInstance.RecordID),
+		tracing.UserIDKey.String(processor),
+	)
+	r.ctx = ctx
+
+	err := r.handle(processor)
+	tracing.End(span, err)
+	return err
+}
+
+// 处理当前节点并流向下一节点
+func (r *NodeRouter) handle(processor string) error {
 	nodeType, err := types.GetNodeTypeByName(r.node.TypeCode)
 	if err != nil {
 		return err
 	}
 
-	if nodeType == types.UserTask && r.parent != nil {
-		pNodeType, err := types.GetNodeTypeByName(r.parent.node.TypeCode)
-		if err != nil {
-			return err
+	if nodeType == types.UserTask && (r.parent != nil || r.resumed) {
+		autoStart := false
+		if r.parent != nil {
+			pNodeType, err := types.GetNodeTypeByName(r.parent.node.TypeCode)
+			if err != nil {
+				return err
+			}
+			autoStart = pNodeType == types.StartEvent && r.parent.opts.autoStart
 		}
 
 		// 不是开始事件也不是自动开始
-		if !(pNodeType == types.StartEvent && r.parent.opts.autoStart) {
+		if !autoStart {
+			candidates, err := r.engine.flowSvc.QueryNodeCandidates(r.ctx, r.nodeInstance.RecordID)
+			if err != nil {
+				return err
+			}
+
+			// 通知人工任务分配事件
+			var cIDs []string
+			for _, c := range candidates {
+				cIDs = append(cIDs, c.CandidateID)
+			}
+			err = r.engine.fire(r.ctx, &Event{
+				Type:         EventTaskAssigned,
+				FlowInstance: r.flowInstance,
+				Node:         r.node,
+				NodeInstance: r.nodeInstance,
+				CandidateIDs: cIDs,
+			})
+			if err != nil {
+				return err
+			}
+
 			// 通知下一节点实例事件
 			if fn := r.opts.onNextNode; fn != nil {
-				candidates, err := r.engine.flowSvc.QueryNodeCandidates(r.nodeInstance.RecordID)
-				if err != nil {
-					return err
-				}
 				fn(r.node, r.nodeInstance, candidates)
 			}
 			return nil
@@ -142,7 +215,20 @@ func (r *NodeRouter) Next(processor string) error {
 	}
 
 	// 完成当前节点
-	err = r.engine.flowSvc.DoneNodeInstance(r.nodeInstance.RecordID, processor, r.inputData)
+	err = r.engine.flowSvc.DoneNodeInstance(r.ctx, r.nodeInstance.RecordID, processor, r.inputData)
+	if err != nil {
+		return err
+	}
+
+	r.nodeInstance.Processor = processor
+	r.nodeInstance.Status = 2
+	err = r.engine.fire(r.ctx, &Event{
+		Type:         EventNodeCompleted,
+		FlowInstance: r.flowInstance,
+		Node:         r.node,
+		NodeInstance: r.nodeInstance,
+		Operator:     processor,
+	})
 	if err != nil {
 		return err
 	}
@@ -155,7 +241,7 @@ func (r *NodeRouter) Next(processor string) error {
 		}
 
 		if ok {
-			exists, err := r.engine.flowSvc.CheckFlowInstanceTodo(r.flowInstance.RecordID)
+			exists, err := r.engine.flowSvc.CheckFlowInstanceTodo(r.ctx, r.flowInstance.RecordID)
 			if err != nil {
 				return err
 			}
@@ -171,7 +257,7 @@ func (r *NodeRouter) Next(processor string) error {
 
 		// 如果是结束事件，则检查还未完成的待办事项，如果没有则结束流程并通知结束事件
 		if nodeType == types.EndEvent {
-			exists, err := r.engine.flowSvc.CheckFlowInstanceTodo(r.flowInstance.RecordID)
+			exists, err := r.engine.flowSvc.CheckFlowInstanceTodo(r.ctx, r.flowInstance.RecordID)
 			if err != nil {
 				return err
 			}
@@ -188,7 +274,19 @@ func (r *NodeRouter) Next(processor string) error {
 
 		if isEnd {
 			// 流程实例结束处理
-			err = r.engine.flowSvc.DoneFlowInstance(r.flowInstance.RecordID)
+			err = r.engine.flowSvc.DoneFlowInstance(r.ctx, r.flowInstance.RecordID, processor)
+			if err != nil {
+				return err
+			}
+
+			r.flowInstance.Status = 9
+			err = r.engine.fire(r.ctx, &Event{
+				Type:         EventFlowEnded,
+				FlowInstance: r.flowInstance,
+				Node:         r.node,
+				NodeInstance: r.nodeInstance,
+				Operator:     processor,
+			})
 			if err != nil {
 				return err
 			}
@@ -201,8 +299,18 @@ func (r *NodeRouter) Next(processor string) error {
 		return nil
 	}
 
+	// 完成节点后异步流转，由作业执行器继续流转
+	if r.node.AsyncAfter == 1 {
+		return r.createJob(model.JobTypeAsyncAfter, processor)
+	}
+
+	return r.leave(processor)
+}
+
+// 离开当前节点，流向下一节点
+func (r *NodeRouter) leave(processor string) error {
 	// 增加下一节点
-	nodeInstanceIDs, err := r.addNextNodeInstances()
+	nodeInstanceIDs, err := r.addNextNodeInstances(processor)
 	if err != nil {
 		return err
 	}
@@ -221,8 +329,8 @@ func (r *NodeRouter) Next(processor string) error {
 }
 
 // 增加下一处理节点实例
-func (r *NodeRouter) addNextNodeInstances() ([]string, error) {
-	routers, err := r.engine.flowSvc.QueryNodeRouters(r.node.RecordID)
+func (r *NodeRouter) addNextNodeInstances(processor string) ([]string, error) {
+	routers, err := r.engine.flowSvc.QueryNodeRouters(r.ctx, r.node.RecordID)
 	if err != nil {
 		return nil, err
 	}
@@ -230,27 +338,47 @@ func (r *NodeRouter) addNextNodeInstances() ([]string, error) {
 		return nil, nil
 	}
 
-	var nodeInstanceIDs []string
+	// 计算所有路由条件并记录路由决策
+	var (
+		decisions []*model.RouteDecision
+		targets   []*model.NodeRouter
+	)
 	for _, routerItem := range routers {
+		allow := true
 		if routerItem.Expression != "" {
-			allow, err := r.engine.execer.ExecReturnBool([]byte(routerItem.Expression), r.getExpData())
+			allow, err = r.execBool(routerItem)
 			if err != nil {
 				return nil, err
 			}
-			if !allow {
-				continue
-			}
 		}
 
+		decisions = append(decisions, &model.RouteDecision{
+			RouterID:     routerItem.RecordID,
+			TargetNodeID: routerItem.TargetNodeID,
+			Expression:   routerItem.Expression,
+			Result:       allow,
+		})
+		if allow {
+			targets = append(targets, routerItem)
+		}
+	}
+
+	err = r.engine.flowSvc.AddRouteHistory(r.ctx, r.nodeInstance, processor, decisions)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodeInstanceIDs []string
+	for _, routerItem := range targets {
 		// 查询指派人表达式
-		assigns, err := r.engine.flowSvc.QueryNodeAssignments(routerItem.TargetNodeID)
+		assigns, err := r.engine.flowSvc.QueryNodeAssignments(r.ctx, routerItem.TargetNodeID)
 		if err != nil {
 			return nil, err
 		}
 
 		var candidates []string
 		for _, assign := range assigns {
-			ss, err := r.engine.execer.ExecReturnStringSlice([]byte(assign.Expression), r.getExpData())
+			ss, err := r.execStringSlice(routerItem.TargetNodeID, assign.Expression)
 			if err != nil {
 				return nil, err
 			}
@@ -258,16 +386,57 @@ func (r *NodeRouter) addNextNodeInstances() ([]string, error) {
 
 		}
 
-		instanceID, err := r.engine.flowSvc.CreateNodeInstance(
+		// 解析候选组、上级及部门
+		props, err := r.engine.flowSvc.GetNodeProperty(r.ctx, routerItem.TargetNodeID)
+		if err != nil {
+			return nil, err
+		}
+		candidates, err = r.engine.resolveCandidates(r.ctx, props, candidates, r.flowInstance.Launcher, processor)
+		if err != nil {
+			return nil, err
+		}
+
+		// 按指派策略选择候选人
+		candidates, err = r.engine.assignCandidates(r.ctx, routerItem.TargetNodeID, props, candidates, hasAssignment(assigns, props))
+		if err != nil {
+			return nil, err
+		}
+
+		// 按委托规则转交给受托人
+		flowCode, err := r.engine.getFlowCode(r.ctx, r.flowInstance.FlowID)
+		if err != nil {
+			return nil, err
+		}
+		nodeCandidates, err := r.engine.flowSvc.ApplyDelegationRules(r.ctx, flowCode, candidates)
+		if err != nil {
+			return nil, err
+		}
+		candidates = make([]string, 0, len(nodeCandidates))
+		for _, c := range nodeCandidates {
+			candidates = append(candidates, c.CandidateID)
+		}
+
+		nodeInstance, err := r.engine.flowSvc.CreateNodeInstance(
+			r.ctx,
 			r.flowInstance.RecordID,
 			routerItem.TargetNodeID,
 			r.inputData,
-			candidates,
+			nodeCandidates,
 		)
 		if err != nil {
 			return nil, err
 		}
-		nodeInstanceIDs = append(nodeInstanceIDs, instanceID)
+
+		err = r.engine.fire(r.ctx, &Event{
+			Type:         EventNodeInstanceCreated,
+			FlowInstance: r.flowInstance,
+			NodeInstance: nodeInstance,
+			CandidateIDs: candidates,
+		})
+		if err != nil {
+			return nil, err
+		}
+		nodeInstanceIDs = append(nodeInstanceIDs, nodeInstance.RecordID)
 	}
 	return nodeInstanceIDs, nil
 }
@@ -280,6 +449,16 @@ func (r *NodeRouter) next(nodeInstanceID, processor string) (*NodeRouter, error)
 	nextRouter.opts = r.opts
 	nextRouter.parent = r
 
+	// 进入节点前异步执行，由作业执行器继续流转
+	// 作业执行前节点实例处于等待异步作业状态，不能被处理也不显示在待办中
+	if nextRouter.node.AsyncBefore == 1 {
+		err = r.engine.flowSvc.UpdateNodeInstanceStatus(r.ctx, nextRouter.nodeInstance, 5)
+		if err != nil {
+			return nil, err
+		}
+		return nextRouter, nextRouter.createJob(model.JobTypeAsyncBefore, processor)
+	}
+
 	err = nextRouter.Next(processor)
 	if err != nil {
 		return nil, err
@@ -287,9 +466,25 @@ func (r *NodeRouter) next(nodeInstanceID, processor string) (*NodeRouter, error)
 	return nextRouter, nil
 }
 
+// 创建当前节点实例的异步作业
+func (r *NodeRouter) createJob(typeCode, processor string) error {
+	job := &model.Job{
+		FlowInstanceID: r.flowInstance.RecordID,
+		NodeInstanceID: r.nodeInstance.RecordID,
+		TypeCode:       typeCode,
+		Processor:      processor,
+		Input:          string(r.inputData),
+		Metadata:       metadata.Encode(r.ctx),
+	}
+	if flag, ok := FromFlagContext(r.ctx); ok {
+		job.Flag = flag
+	}
+	return r.engine.flowSvc.CreateJob(r.ctx, job)
+}
+
 // 检查下一节点类型
 func (r *NodeRouter) checkNextNodeType(t types.NodeType) (bool, error) {
-	routers, err := r.engine.flowSvc.QueryNodeRouters(r.node.RecordID)
+	routers, err := r.engine.flowSvc.QueryNodeRouters(r.ctx, r.node.RecordID)
 	if err != nil {
 		return false, err
 	}
@@ -299,7 +494,7 @@ func (r *NodeRouter) checkNextNodeType(t types.NodeType) (bool, error) {
 
 	for _, routerItem := range routers {
 		if routerItem.Expression != "" {
-			allow, err := r.engine.execer.ExecReturnBool([]byte(routerItem.Expression), r.getExpData())
+			allow, err := r.engine.execer.ExecReturnBool(r.ctx, []byte(routerItem.Expression), r.getExpData())
 			if err != nil {
 				return false, err
 			}
@@ -309,7 +504,7 @@ func (r *NodeRouter) checkNextNodeType(t types.NodeType) (bool, error) {
 			}
 		}
 
-		node, err := r.engine.flowSvc.GetNode(routerItem.TargetNodeID)
+		node, err := r.engine.flowSvc.GetNode(r.ctx, routerItem.TargetNodeID)
 		if err != nil {
 			return false, err
 		}
@@ -326,6 +521,77 @@ func (r *NodeRouter) checkNextNodeType(t types.NodeType) (bool, error) {
 	return false, nil
 }
 
+// 执行路由条件表达式
+func (r *NodeRouter) execBool(routerItem *model.NodeRouter) (bool, error) {
+	input := r.getExpData()
+	start := time.Now()
+	result, err := r.engine.execer.ExecReturnBool(r.ctx, []byte(routerItem.Expression), input)
+	return result, r.trace(model.ExpressionKindCondition, routerItem.TargetNodeID, routerItem.Expression, input, start, result, err)
+}
+
+// 执行指派人表达式
+func (r *NodeRouter) execStringSlice(targetNodeID, exp string) ([]string, error) {
+	input := r.getExpData()
+	start := time.Now()
+	result, err := r.engine.execer.ExecReturnStringSlice(r.ctx, []byte(exp), input)
+	return result, r.trace(model.ExpressionKindAssignment, targetNodeID, exp, input, start, result, err)
+}
+
+// 记录表达式执行结果，返回表达式的执行错误或保存记录的错误
+func (r *NodeRouter) trace(
+	kind, targetNodeID, exp string,
+	input []byte,
+	start time.Time,
+	result interface{},
+	err error,
+) error {
+	duration := time.Since(start)
+	r.engine.metrics.ExpressionEvaluated(kind, duration, err)
+
+	item := &model.ExpressionTrace{
+		RecordID:       util.UUID(),
+		FlowInstanceID: r.flowInstance.RecordID,
+		NodeInstanceID: r.nodeInstance.RecordID,
+		TargetNodeID:   targetNodeID,
+		Kind:           kind,
+		Expression:     exp,
+		Input:          string(input),
+		Duration:       duration.Microseconds(),
+		Created:        time.Now().Unix(),
+	}
+	if err != nil {
+		item.Error = err.Error()
+	} else {
+		b, _ := json.Marshal(result)
+		item.Result = string(b)
+	}
+
+	logger.Debug(r.ctx, r.engine.logger, "执行表达式",
+		logger.F(logger.FlowInstanceIDKey, item.FlowInstanceID),
+		logger.F(logger.NodeCodeKey, r.node.Code),
+		logger.F("kind", item.Kind),
+		logger.F("expression", item.Expression),
+		logger.F("result", item.Result),
+		logger.F("error", item.Error),
+		logger.F("duration_us", item.Duration),
+	)
+
+	if fn := r.opts.onTrace; fn != nil {
+		fn(item)
+	}
+	if r.engine.traceExpressions {
+		sctx := r.ctx
+		if err != nil {
+			// 执行失败时流转的事务将回滚，在事务外保存记录以便排查失败原因
+			sctx = db.WithoutTransContext(r.ctx)
+		}
+		if serr := r.engine.flowSvc.CreateExpressionTrace(sctx, item); serr != nil && err == nil {
+			return serr
+		}
+	}
+	return err
+}
+
 // 获取表达式数据
 func (r *NodeRouter) getExpData() []byte {
 	var input map[string]interface{}
@@ -335,6 +601,7 @@ func (r *NodeRouter) getExpData() []byte {
 		"input": input,
 		"flow":  r.flowInstance,
 		"node":  r.nodeInstance,
+		"vars":  r.vars,
 	}
 	b, _ := json.Marshal(expData)
 	return b
@@ -0,0 +1,148 @@
+package kitten
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/chapin666/kitten/pkg/logger"
+	"github.com/chapin666/kitten/pkg/publisher"
+	"github.com/chapin666/kitten/pkg/retry"
+	"github.com/chapin666/kitten/pkg/util"
+)
+
+// EnableOutbox 启用事件发件箱，types为空时保存所有事件
+// 事件与流程数据变更在同一事务中保存到发件箱，由OutboxRelay投递，流程数据变更提交后事件不会丢失
+func (e *Engine) EnableOutbox(types ...EventType) {
+	e.AddListener(e.saveOutbox, types...)
+}
+
+// 保存事件到发件箱
+func (e *Engine) saveOutbox(ctx context.Context, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var flowInstanceID string
+	if event.FlowInstance != nil {
+		flowInstanceID = event.FlowInstance.RecordID
+	}
+	return e.flowSvc.CreateOutbox(ctx, string(event.Type), flowInstanceID, payload)
+}
+
+type outboxRelayOptions struct {
+	batchSize    int
+	interval     time.Duration
+	lockDuration time.Duration
+	backoff      retry.Sleep
+}
+
+// OutboxRelayOption 发件箱中继配置
+type OutboxRelayOption func(*outboxRelayOptions)
+
+// OutboxBatchSizeOption 设定每次投递的事件数量
+func OutboxBatchSizeOption(size int) OutboxRelayOption {
+	return func(o *outboxRelayOptions) {
+		o.batchSize = size
+	}
+}
+
+// OutboxIntervalOption 设定获取待投递事件的间隔
+func OutboxIntervalOption(interval time.Duration) OutboxRelayOption {
+	return func(o *outboxRelayOptions) {
+		o.interval = interval
+	}
+}
+
+// OutboxLockDurationOption 设定事件的锁定时长，超过锁定时长未投递的事件可以被其他中继重新获取
+func OutboxLockDurationOption(d time.Duration) OutboxRelayOption {
+	return func(o *outboxRelayOptions) {
+		o.lockDuration = d
+	}
+}
+
+// OutboxBackoffOption 设定投递失败后的重试间隔(参数为已投递次数)
+func OutboxBackoffOption(backoff retry.Sleep) OutboxRelayOption {
+	return func(o *outboxRelayOptions) {
+		o.backoff = backoff
+	}
+}
+
+// OutboxRelay 发件箱中继，将发件箱中的事件投递到发布者
+// 事件在发布成功后标记为已投递，发布成功但标记失败时会被重新投递(至少一次)，接收方可以根据消息ID去重
+type OutboxRelay struct {
+	engine    *Engine
+	publisher publisher.Publisher
+	owner     string
+	opts      *outboxRelayOptions
+}
+
+// NewOutboxRelay 创建发件箱中继
+func (e *Engine) NewOutboxRelay(pub publisher.Publisher, options ...OutboxRelayOption) *OutboxRelay {
+	opts := &outboxRelayOptions{
+		batchSize:    100,
+		interval:     time.Second,
+		lockDuration: time.Minute,
+		backoff:      retry.Backoff(5*time.Second, 10*time.Minute),
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	return &OutboxRelay{
+		engine:    e,
+		publisher: pub,
+		owner:     util.UUID(),
+		opts:      opts,
+	}
+}
+
+// Run 定时投递发件箱中的事件，直到ctx结束
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Relay(ctx); err != nil {
+				r.engine.logError(ctx, "投递发件箱事件发生错误", err)
+			}
+		}
+	}
+}
+
+// Relay 投递一批发件箱中的事件
+func (r *OutboxRelay) Relay(ctx context.Context) error {
+	items, err := r.engine.flowSvc.AcquireOutboxes(ctx, r.owner, r.opts.lockDuration, r.opts.batchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		msg := &publisher.Message{
+			ID:      item.RecordID,
+			Topic:   item.EventType,
+			Payload: []byte(item.Payload),
+			Created: item.Created,
+		}
+
+		err := r.publisher.Publish(ctx, msg)
+		if err != nil {
+			r.engine.logError(ctx, "投递事件发生错误", err,
+				logger.F("outbox_id", item.RecordID),
+				logger.F(logger.FlowInstanceIDKey, item.FlowInstanceID),
+			)
+			err = r.engine.flowSvc.FailOutbox(ctx, item, err, r.opts.backoff(int(item.Attempts+1)))
+		} else {
+			err = r.engine.flowSvc.DeliverOutbox(ctx, item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
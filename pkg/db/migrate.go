@@ -0,0 +1,244 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-gorp/gorp"
+	"github.com/pkg/errors"
+)
+
+// 文本类型由小到大的顺序
+var textTypes = []string{"varchar", "text", "mediumtext", "longtext"}
+
+type tableInfo struct {
+	name    string
+	columns []*columnInfo
+	uniques [][]string
+}
+
+type columnInfo struct {
+	name    string
+	sqlType string
+	isText  bool
+	isNum   bool
+}
+
+// TableMap 表映射，记录联合唯一索引用于迁移
+type TableMap struct {
+	*gorp.TableMap
+	table *tableInfo
+}
+
+// SetUniqueTogether 设置联合唯一索引，迁移时补充已存在的表中缺失的唯一索引
+func (t *TableMap) SetUniqueTogether(columns ...string) *TableMap {
+	t.TableMap.SetUniqueTogether(columns...)
+	t.table.uniques = append(t.table.uniques, columns)
+	return t
+}
+
+// AddTableWithName 注册表映射，并记录表结构用于迁移
+func (m *DB) AddTableWithName(i interface{}, name string) *TableMap {
+	t := reflect.TypeOf(i)
+	table := &tableInfo{name: name}
+	for j := 0; j < t.NumField(); j++ {
+		if col := m.parseColumn(t.Field(j)); col != nil {
+			table.columns = append(table.columns, col)
+		}
+	}
+	m.tables = append(m.tables, table)
+
+	return &TableMap{TableMap: m.DbMap.AddTableWithName(i, name), table: table}
+}
+
+func (m *DB) parseColumn(f reflect.StructField) *columnInfo {
+	args := strings.Split(f.Tag.Get("db"), ",")
+	if args[0] == "" || args[0] == "-" {
+		return nil
+	}
+
+	var (
+		maxSize int
+		isAuto  bool
+	)
+	for _, arg := range args[1:] {
+		arg = strings.TrimSpace(arg)
+		if strings.HasPrefix(arg, "size:") {
+			maxSize, _ = strconv.Atoi(strings.TrimPrefix(arg, "size:"))
+		} else if arg == "autoincrement" {
+			isAuto = true
+		}
+	}
+
+	sqlType := m.Dialect.ToSqlType(f.Type, maxSize, isAuto)
+	col := &columnInfo{
+		name:    args[0],
+		sqlType: sqlType,
+	}
+	switch f.Type.Kind() {
+	case reflect.String:
+		col.isText = true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool:
+		col.isNum = true
+	}
+	return col
+}
+
+// MigrateTables 迁移已存在的表结构
+// 补充表中缺失的字段及联合唯一索引，并将容量不足的文本字段扩容为当前定义的类型(不会缩小或删除字段及索引)
+func (m *DB) MigrateTables() error {
+	for _, table := range m.tables {
+		if err := m.migrateTable(table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DB) migrateTable(table *tableInfo) error {
+	var items []struct {
+		Name     string `db:"COLUMN_NAME"`
+		DataType string `db:"DATA_TYPE"`
+	}
+	_, err := m.Select(&items, "SELECT COLUMN_NAME,DATA_TYPE FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=?", table.name)
+	if err != nil {
+		return errors.Wrapf(err, "查询表[%s]结构发生错误", table.name)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	exists := make(map[string]string)
+	for _, item := range items {
+		exists[strings.ToLower(item.Name)] = strings.ToLower(item.DataType)
+	}
+
+	for _, col := range table.columns {
+		dataType, ok := exists[strings.ToLower(col.name)]
+		if !ok {
+			if err := m.addColumn(table.name, col); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if col.isText && textTypeIndex(dataType) >= 0 &&
+			textTypeIndex(dataType) < textTypeIndex(baseType(col.sqlType)) {
+			query := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table.name, col.name, col.sqlType)
+			if _, err := m.Exec(query); err != nil {
+				return errors.Wrapf(err, "扩容字段[%s.%s]发生错误", table.name, col.name)
+			}
+		}
+	}
+	return m.migrateUniques(table)
+}
+
+// 补充缺失的联合唯一索引(已有重复数据时创建失败，需要先清理重复数据)
+func (m *DB) migrateUniques(table *tableInfo) error {
+	if len(table.uniques) == 0 {
+		return nil
+	}
+
+	var items []struct {
+		IndexName  string `db:"INDEX_NAME"`
+		ColumnName string `db:"COLUMN_NAME"`
+	}
+	_, err := m.Select(&items, "SELECT INDEX_NAME,COLUMN_NAME FROM information_schema.STATISTICS "+
+		"WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=? AND NON_UNIQUE=0 ORDER BY INDEX_NAME,SEQ_IN_INDEX", table.name)
+	if err != nil {
+		return errors.Wrapf(err, "查询表[%s]索引发生错误", table.name)
+	}
+	indexes := make(map[string][]string)
+	for _, item := range items {
+		indexes[item.IndexName] = append(indexes[item.IndexName], strings.ToLower(item.ColumnName))
+	}
+
+	for _, columns := range table.uniques {
+		if hasUniqueIndex(indexes, columns) {
+			continue
+		}
+
+		name := uniqueIndexName(columns)
+		query := fmt.Sprintf("ALTER TABLE %s ADD UNIQUE INDEX %s (%s)", table.name, name, strings.Join(columns, ","))
+		if _, err := m.Exec(query); err != nil {
+			return errors.Wrapf(err, "创建唯一索引[%s.%s]发生错误", table.name, name)
+		}
+	}
+	return nil
+}
+
+// 检查是否存在字段及顺序一致的唯一索引
+func hasUniqueIndex(indexes map[string][]string, columns []string) bool {
+	for _, indexColumns := range indexes {
+		if len(indexColumns) != len(columns) {
+			continue
+		}
+
+		match := true
+		for i, column := range columns {
+			if indexColumns[i] != strings.ToLower(column) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// 生成唯一索引名称(MySQL索引名称最长64个字符)
+func uniqueIndexName(columns []string) string {
+	name := "uk_" + strings.Join(columns, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// 增加字段，已有数据使用空值填充
+func (m *DB) addColumn(table string, col *columnInfo) error {
+	definition := col.sqlType
+	switch {
+	case col.isNum:
+		definition = fmt.Sprintf("%s NOT NULL DEFAULT 0", definition)
+	case col.isText && baseType(col.sqlType) == "varchar":
+		definition = fmt.Sprintf("%s NOT NULL DEFAULT ''", definition)
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, definition)
+	if _, err := m.Exec(query); err != nil {
+		return errors.Wrapf(err, "增加字段[%s.%s]发生错误", table, col.name)
+	}
+
+	// 大文本字段不支持默认值，已有数据更新为空字符串
+	if col.isText && baseType(col.sqlType) != "varchar" {
+		query = fmt.Sprintf("UPDATE %s SET %s='' WHERE %s IS NULL", table, col.name, col.name)
+		if _, err := m.Exec(query); err != nil {
+			return errors.Wrapf(err, "初始化字段[%s.%s]发生错误", table, col.name)
+		}
+	}
+	return nil
+}
+
+func baseType(sqlType string) string {
+	if i := strings.Index(sqlType, "("); i > 0 {
+		return sqlType[:i]
+	}
+	return sqlType
+}
+
+func textTypeIndex(dataType string) int {
+	for i, t := range textTypes {
+		if t == dataType {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-gorp/gorp"
+)
+
+type testItem struct {
+	ID      int64  `db:"id,primarykey,autoincrement"`
+	Code    string `db:"code,size:50"`
+	Value   string `db:"value,size:1024"`
+	Expr    string `db:"expr,size:65535"`
+	Data    string `db:"data,size:16777215"`
+	Ignored string `db:"-"`
+}
+
+func TestAddTableWithName(t *testing.T) {
+	m := &DB{DbMap: &gorp.DbMap{Dialect: MySQLDialect{}}}
+	m.AddTableWithName(testItem{}, "t_item")
+
+	if len(m.tables) != 1 {
+		t.Fatalf("tables = %d, want 1", len(m.tables))
+	}
+
+	want := map[string]string{
+		"id":    "bigint",
+		"code":  "varchar(50)",
+		"value": "text",
+		"expr":  "text",
+		"data":  "mediumtext",
+	}
+	cols := m.tables[0].columns
+	if len(cols) != len(want) {
+		t.Fatalf("columns = %d, want %d", len(cols), len(want))
+	}
+	for _, col := range cols {
+		if col.sqlType != want[col.name] {
+			t.Errorf("column %s type = %s, want %s", col.name, col.sqlType, want[col.name])
+		}
+	}
+}
+
+func TestTextTypeIndex(t *testing.T) {
+	if textTypeIndex("text") >= textTypeIndex(baseType("mediumtext")) {
+		t.Error("text should be smaller than mediumtext")
+	}
+	if textTypeIndex(baseType("varchar(36)")) != 0 {
+		t.Error("varchar should be the smallest text type")
+	}
+	if textTypeIndex("bigint") != -1 {
+		t.Error("bigint is not a text type")
+	}
+}
+
+func TestSetUniqueTogether(t *testing.T) {
+	m := &DB{DbMap: &gorp.DbMap{Dialect: MySQLDialect{}}}
+	m.AddTableWithName(testItem{}, "t_item").SetUniqueTogether("code", "value")
+
+	uniques := m.tables[0].uniques
+	if len(uniques) != 1 || strings.Join(uniques[0], ",") != "code,value" {
+		t.Errorf("uniques = %v, want [[code value]]", uniques)
+	}
+}
+
+func TestHasUniqueIndex(t *testing.T) {
+	indexes := map[string][]string{
+		"PRIMARY":       {"id"},
+		"uk_code_value": {"code", "value"},
+	}
+	if !hasUniqueIndex(indexes, []string{"code", "value"}) {
+		t.Error("index (code,value) should exist")
+	}
+	if hasUniqueIndex(indexes, []string{"value", "code"}) {
+		t.Error("index (value,code) should not match a different column order")
+	}
+	if hasUniqueIndex(indexes, []string{"code"}) {
+		t.Error("index (code) should not match a wider index")
+	}
+	if name := uniqueIndexName([]string{"tenant_id", "idempotency_key", "operation"}); name != "uk_tenant_id_idempotency_key_operation" {
+		t.Errorf("unique index name = %s", name)
+	}
+}
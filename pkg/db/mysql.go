@@ -2,13 +2,14 @@ package db
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/go-gorp/gorp"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
+	"github.com/chapin666/kitten/pkg/logger"
 	"github.com/chapin666/kitten/pkg/retry"
-	"log"
 	"os"
 	"reflect"
 	"strings"
@@ -18,23 +19,35 @@ import (
 // M 定义字典
 type M map[string]interface{}
 
-// 自定义数据库语句打印日志
+// 自定义数据库语句打印日志(调试级别)
 type dbLogger struct {
-	logger *log.Logger
+	logger logger.Logger
 }
 
-func (l *dbLogger) Init() gorp.GorpLogger {
-	l.logger = log.New(os.Stdout, "", log.Lmicroseconds)
+func (l *dbLogger) Init(lg logger.Logger) gorp.GorpLogger {
+	l.logger = lg
+	if l.logger == nil {
+		l.logger = logger.New(os.Stdout, logger.DebugLevel)
+	}
 	return l
 }
 
 func (l *dbLogger) Printf(format string, v ...interface{}) {
+	// gorp的追踪参数依次为：前缀、语句、参数、耗时
+	if len(v) != 4 {
+		logger.Debug(context.Background(), l.logger, fmt.Sprintf(format, v...))
+		return
+	}
+
 	query := fmt.Sprint(v[1])
 	query = strings.Replace(query, "\n", " ", -1)
 	query = strings.Replace(query, "\t", "", -1)
-	v[1] = query
 
-	l.logger.Printf(format, v...)
+	logger.Debug(context.Background(), l.logger, fmt.Sprint(v[0]),
+		logger.F("sql", query),
+		logger.F("args", v[2]),
+		logger.F("duration", v[3]),
+	)
 }
 
 type options struct {
@@ -43,6 +56,7 @@ type options struct {
 	maxLifetime  time.Duration // 设置连接可以被重新使用的最大时间量
 	maxOpenConns int           // 设置打开连接到数据库的最大数量
 	maxIdleConns int           // 设置空闲连接池中的最大连接数
+	logger       logger.Logger // 日志
 }
 
 // Option 配置项
@@ -83,9 +97,38 @@ func SetMaxIdleConns(maxIdleConns int) Option {
 	}
 }
 
+// SetLogger 设置日志(连接错误及追踪调试的语句)
+func SetLogger(l logger.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// MySQLDialect MySQL方言
+// 在gorp.MySQLDialect的基础上支持大文本类型：
+// size 小于256时为 varchar(size)，小于65536时为 text，小于16777216时为 mediumtext，否则为 longtext
+// 类型名称与gorp保持一致，gorp按方言类型名称生成MySQL的索引语句
+type MySQLDialect struct {
+	gorp.MySQLDialect
+}
+
+// ToSqlType 获取字段对应的数据库类型
+func (d MySQLDialect) ToSqlType(val reflect.Type, maxsize int, isAutoIncr bool) string {
+	if val.Kind() == reflect.String {
+		switch {
+		case maxsize > 16777215:
+			return "longtext"
+		case maxsize > 65535:
+			return "mediumtext"
+		}
+	}
+	return d.MySQLDialect.ToSqlType(val, maxsize, isAutoIncr)
+}
+
 // DB 数据库
 type DB struct {
 	*gorp.DbMap
+	tables []*tableInfo
 }
 
 // NewMySQL 创建MySQL数据库实例
@@ -108,8 +151,8 @@ func NewMySQL(opts ...Option) (*sql.DB, bool, error) {
 	// 尝试发送Ping包
 	err = retry.DoFunc(3, func() error {
 		perr := db.Ping()
-		if perr != nil {
-			fmt.Println("发送ping值错误：", perr.Error())
+		if perr != nil && o.logger != nil {
+			logger.Warn(context.Background(), o.logger, "发送ping值错误", logger.Err(perr))
 		}
 		return perr
 	}, func(i int) time.Duration {
@@ -127,13 +170,20 @@ func NewMySQL(opts ...Option) (*sql.DB, bool, error) {
 }
 
 // NewMySQLWithDB 创建DB
-func NewMySQLWithDB(db *sql.DB, trace bool) *DB {
-	dbMap := &gorp.DbMap{Db: db, Dialect: gorp.MySQLDialect{Encoding: "UTF8", Engine: "InnoDB"}}
+// opts 仅使用日志配置(SetLogger)，未设置时追踪调试的语句输出到标准输出
+func NewMySQLWithDB(db *sql.DB, trace bool, opts ...Option) *DB {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	dialect := MySQLDialect{gorp.MySQLDialect{Encoding: "UTF8", Engine: "InnoDB"}}
+	dbMap := &gorp.DbMap{Db: db, Dialect: dialect}
 	if trace {
-		dbMap.TraceOn("[db]", new(dbLogger).Init())
+		dbMap.TraceOn("[db]", new(dbLogger).Init(o.logger))
 	}
 
-	return &DB{dbMap}
+	return &DB{DbMap: dbMap}
 }
 
 // Close 关闭数据库连接
@@ -395,3 +445,9 @@ func (m *DB) appendReflectSlice(args []interface{}, v reflect.Value, vlen int) [
 
 	return args
 }
+
+// IsDuplicate 检查错误是否为唯一键冲突错误(MySQL错误码1062)
+func IsDuplicate(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	err := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+	if !IsDuplicate(err) {
+		t.Error("IsDuplicate(1062) = false, want true")
+	}
+	if !IsDuplicate(errors.Wrapf(err, "创建幂等记录发生错误")) {
+		t.Error("IsDuplicate(wrapped 1062) = false, want true")
+	}
+	if IsDuplicate(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"}) {
+		t.Error("IsDuplicate(1213) = true, want false")
+	}
+	if IsDuplicate(nil) {
+		t.Error("IsDuplicate(nil) = true, want false")
+	}
+}
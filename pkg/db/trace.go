@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/chapin666/kitten/pkg/tracing"
+	"github.com/go-gorp/gorp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 为每次数据库操作创建span的SQL执行器
+type tracedExecutor struct {
+	exec gorp.SqlExecutor
+	ctx  context.Context
+}
+
+// 上下文中存在span时为SQL执行器增加追踪
+func withTrace(ctx context.Context, exec gorp.SqlExecutor) gorp.SqlExecutor {
+	if !tracing.HasSpan(ctx) {
+		return exec
+	}
+	return &tracedExecutor{exec: exec, ctx: ctx}
+}
+
+func (t *tracedExecutor) start(name, query string) trace.Span {
+	attrs := []attribute.KeyValue{tracing.DBSystemKey.String("mysql")}
+	if query != "" {
+		attrs = append(attrs, tracing.DBStatementKey.String(query))
+	}
+	_, span := tracing.Start(t.ctx, name, attrs...)
+	return span
+}
+
+func (t *tracedExecutor) WithContext(ctx context.Context) gorp.SqlExecutor {
+	return withTrace(ctx, t.exec.WithContext(ctx))
+}
+
+func (t *tracedExecutor) Get(i interface{}, keys ...interface{}) (interface{}, error) {
+	span := t.start("db.Get", "")
+	v, err := t.exec.Get(i, keys...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) Insert(list ...interface{}) error {
+	span := t.start("db.Insert", "")
+	err := t.exec.Insert(list...)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedExecutor) Update(list ...interface{}) (int64, error) {
+	span := t.start("db.Update", "")
+	n, err := t.exec.Update(list...)
+	tracing.End(span, err)
+	return n, err
+}
+
+func (t *tracedExecutor) Delete(list ...interface{}) (int64, error) {
+	span := t.start("db.Delete", "")
+	n, err := t.exec.Delete(list...)
+	tracing.End(span, err)
+	return n, err
+}
+
+func (t *tracedExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	span := t.start("db.Exec", query)
+	result, err := t.exec.Exec(query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (t *tracedExecutor) Select(i interface{}, query string, args ...interface{}) ([]interface{}, error) {
+	span := t.start("db.Select", query)
+	list, err := t.exec.Select(i, query, args...)
+	tracing.End(span, err)
+	return list, err
+}
+
+func (t *tracedExecutor) SelectInt(query string, args ...interface{}) (int64, error) {
+	span := t.start("db.Select", query)
+	v, err := t.exec.SelectInt(query, args...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) SelectNullInt(query string, args ...interface{}) (sql.NullInt64, error) {
+	span := t.start("db.Select", query)
+	v, err := t.exec.SelectNullInt(query, args...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) SelectFloat(query string, args ...interface{}) (float64, error) {
+	span := t.start("db.Select", query)
+	v, err := t.exec.SelectFloat(query, args...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) SelectNullFloat(query string, args ...interface{}) (sql.NullFloat64, error) {
+	span := t.start("db.Select", query)
+	v, err := t.exec.SelectNullFloat(query, args...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) SelectStr(query string, args ...interface{}) (string, error) {
+	span := t.start("db.Select", query)
+	v, err := t.exec.SelectStr(query, args...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) SelectNullStr(query string, args ...interface{}) (sql.NullString, error) {
+	span := t.start("db.Select", query)
+	v, err := t.exec.SelectNullStr(query, args...)
+	tracing.End(span, err)
+	return v, err
+}
+
+func (t *tracedExecutor) SelectOne(holder interface{}, query string, args ...interface{}) error {
+	span := t.start("db.Select", query)
+	err := t.exec.SelectOne(holder, query, args...)
+	if err == sql.ErrNoRows {
+		// 未查询到数据不作为错误记录
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	return err
+}
+
+func (t *tracedExecutor) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	span := t.start("db.Query", query)
+	rows, err := t.exec.Query(query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+func (t *tracedExecutor) QueryRow(query string, args ...interface{}) *sql.Row {
+	span := t.start("db.Query", query)
+	row := t.exec.QueryRow(query, args...)
+	tracing.End(span, nil)
+	return row
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/go-gorp/gorp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeExecutor struct {
+	gorp.SqlExecutor
+}
+
+func (fakeExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func TestWithTrace(t *testing.T) {
+	exec := fakeExecutor{}
+	if _, ok := withTrace(context.Background(), exec).(*tracedExecutor); ok {
+		t.Fatal("executor should not be traced without a span")
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "parent")
+
+	_, _ = withTrace(ctx, exec).Exec("UPDATE f_job SET status=2")
+	span.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "db.Exec" {
+		t.Fatalf("spans = %v, want db.Exec and parent", spans)
+	}
+}
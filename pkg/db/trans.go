@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+
+	"github.com/go-gorp/gorp"
+	"github.com/pkg/errors"
+)
+
+type transKey struct{}
+
+// NewTransContext 创建携带事务的上下文
+func NewTransContext(ctx context.Context, tran *gorp.Transaction) context.Context {
+	return context.WithValue(ctx, transKey{}, tran)
+}
+
+// FromTransContext 从上下文中获取事务
+func FromTransContext(ctx context.Context) (*gorp.Transaction, bool) {
+	tran, ok := ctx.Value(transKey{}).(*gorp.Transaction)
+	return tran, ok && tran != nil
+}
+
+// WithoutTransContext 创建不携带事务的上下文，用于在事务外保存不随事务回滚的数据
+func WithoutTransContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transKey{}, (*gorp.Transaction)(nil))
+}
+
+// Executor 获取SQL执行器，上下文中存在事务时使用事务执行
+// 上下文中存在追踪的span时，每次数据库操作创建子span
+func (m *DB) Executor(ctx context.Context) gorp.SqlExecutor {
+	if tran, ok := FromTransContext(ctx); ok {
+		return withTrace(ctx, tran.WithContext(ctx))
+	}
+	return withTrace(ctx, m.DbMap.WithContext(ctx))
+}
+
+// ExecTrans 在事务中执行函数，函数返回错误时回滚事务
+// 上下文中已存在事务时直接使用该事务执行，由外层负责提交或回滚
+func (m *DB) ExecTrans(ctx context.Context, fn func(context.Context) error) error {
+	if _, ok := FromTransContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	tran, err := m.Begin()
+	if err != nil {
+		return errors.Wrapf(err, "开启事物发生错误")
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tran.Rollback()
+			panic(r)
+		}
+	}()
+
+	err = fn(NewTransContext(ctx, tran))
+	if err != nil {
+		_ = tran.Rollback()
+		return err
+	}
+
+	err = tran.Commit()
+	if err != nil {
+		return errors.Wrapf(err, "提交事物发生错误")
+	}
+	return nil
+}
+
+// InsertContext 插入数据(上下文中存在事务时使用事务执行)
+func (m *DB) InsertContext(ctx context.Context, list ...interface{}) error {
+	return m.Executor(ctx).Insert(list...)
+}
+
+// UpdateByPKContext 更新表数据(上下文中存在事务时使用事务执行)
+func (m *DB) UpdateByPKContext(ctx context.Context, table string, pk, info M) (int64, error) {
+	q, vals := m.UpdateSQL(table, pk, info)
+	result, err := m.Executor(ctx).Exec(q, vals...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-gorp/gorp"
+)
+
+func TestWithoutTransContext(t *testing.T) {
+	ctx := NewTransContext(context.Background(), new(gorp.Transaction))
+	if _, ok := FromTransContext(ctx); !ok {
+		t.Fatal("context should carry the transaction")
+	}
+	if _, ok := FromTransContext(WithoutTransContext(ctx)); ok {
+		t.Error("context should not carry the transaction")
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-gorp/gorp"
+	"github.com/pkg/errors"
+)
+
+// ConflictError 并发冲突错误(数据已被其他操作修改)
+type ConflictError struct {
+	Table    string
+	RecordID interface{}
+	Version  int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("数据[%s:%v]已被修改(版本:%d)，请刷新后重试", e.Table, e.RecordID, e.Version)
+}
+
+// IsConflict 检查错误是否为并发冲突错误
+func IsConflict(err error) bool {
+	var ce *ConflictError
+	return errors.As(err, &ce)
+}
+
+// UpdateByVersionContext 使用乐观锁更新表数据(上下文中存在事务时使用事务执行)
+// 仅在数据版本与version一致时更新，并将版本号加1；未更新到数据时返回ConflictError
+func (m *DB) UpdateByVersionContext(ctx context.Context, table string, pk M, version int64, info M) error {
+	return m.updateByVersion(m.Executor(ctx), table, pk, version, info)
+}
+
+// UpdateByVersionWithTran 使用事物及乐观锁更新表数据
+func (m *DB) UpdateByVersionWithTran(tran *gorp.Transaction, table string, pk M, version int64, info M) error {
+	return m.updateByVersion(tran, table, pk, version, info)
+}
+
+func (m *DB) updateByVersion(exec gorp.SqlExecutor, table string, pk M, version int64, info M) error {
+	where := M{"version": version}
+	for k, v := range pk {
+		where[k] = v
+	}
+
+	data := M{"version": version + 1}
+	for k, v := range info {
+		data[k] = v
+	}
+
+	q, vals := m.UpdateSQL(table, where, data)
+	result, err := exec.Exec(q, vals...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return &ConflictError{Table: table, RecordID: pk["record_id"], Version: version}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestIsConflict(t *testing.T) {
+	err := &ConflictError{Table: "t_item", RecordID: "1", Version: 2}
+	if !IsConflict(err) {
+		t.Error("IsConflict(ConflictError) = false, want true")
+	}
+	if !IsConflict(errors.Wrapf(err, "更新数据发生错误")) {
+		t.Error("IsConflict(wrapped ConflictError) = false, want true")
+	}
+	if IsConflict(errors.New("其他错误")) {
+		t.Error("IsConflict(other error) = true, want false")
+	}
+	if IsConflict(nil) {
+		t.Error("IsConflict(nil) = true, want false")
+	}
+}
@@ -13,7 +13,12 @@ type dbkey struct{}
 // CreateExpContext 创建一个ExpContext
 // 实现了context.Context接口
 func CreateExpContext() ExpContext {
-	ctx := context.Background()
+	return CreateExpContextWith(context.Background())
+}
+
+// CreateExpContextWith 基于调用方的上下文创建ExpContext
+// 上下文的取消、超时及追踪信息会传递到表达式的执行
+func CreateExpContextWith(ctx context.Context) ExpContext {
 	return &expContext{
 		ctx:        ctx,
 		ql:         qlang.New(),
@@ -64,7 +69,7 @@ func (c *expContext) Err() error {
 	if c.err != nil {
 		return c.err
 	}
-	return c.Err()
+	return c.ctx.Err()
 }
 
 // Value context.Context 接口实现
@@ -7,6 +7,7 @@ import (
 
 	"github.com/xushiwei/qlang"
 
+	"github.com/chapin666/kitten/pkg/tracing"
 	"github.com/pkg/errors"
 )
 
@@ -36,6 +37,11 @@ func (e *execExp) SetLibs(libs string) {
 	e.libs = libs
 }
 func (e execExp) Exec(ctx ExpContext, exp string) (out *OutData, err error) {
+	_, span := tracing.Start(ctx, "expression.Exec", tracing.ExpressionKey.String(exp))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	ql := qlangFromContext(ctx)
 	ql.SetLibs(e.libs)
 	resultKey, expdata := e.parse(ctx, exp)
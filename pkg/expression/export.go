@@ -1,5 +1,7 @@
 package expression
 
+import "context"
+
 var (
 	defaultExp = CreateExecer("")
 )
@@ -26,7 +28,12 @@ func Exec(ctx ExpContext, exp string) (*OutData, error) {
 
 // ExecParam 执行表达式
 func ExecParam(exp string, vars map[string]interface{}) (*OutData, error) {
-	ectx := CreateExpContext()
+	return ExecParamContext(context.Background(), exp, vars)
+}
+
+// ExecParamContext 基于调用方的上下文执行表达式
+func ExecParamContext(ctx context.Context, exp string, vars map[string]interface{}) (*OutData, error) {
+	ectx := CreateExpContextWith(ctx)
 	for key, v := range vars {
 		ectx.AddVar(key, v)
 	}
@@ -38,11 +45,21 @@ func ExecParamBool(exp string, vars map[string]interface{}) (bool, error) {
 	return Bool(ExecParam(exp, vars))
 }
 
+// ExecParamBoolContext 基于调用方的上下文执行表达式　返回布尔型
+func ExecParamBoolContext(ctx context.Context, exp string, vars map[string]interface{}) (bool, error) {
+	return Bool(ExecParamContext(ctx, exp, vars))
+}
+
 // ExecParamSliceStr 执行表达式，返回字符串切片
 func ExecParamSliceStr(exp string, vars map[string]interface{}) ([]string, error) {
 	return SliceStr(ExecParam(exp, vars))
 }
 
+// ExecParamSliceStrContext 基于调用方的上下文执行表达式，返回字符串切片
+func ExecParamSliceStrContext(ctx context.Context, exp string, vars map[string]interface{}) ([]string, error) {
+	return SliceStr(ExecParamContext(ctx, exp, vars))
+}
+
 // ExecPredefineVar 执行表达式,传入预编译参数
 func ExecPredefineVar(exp string, key string, predefinestr string) (*OutData, error) {
 	ectx := CreateExpContext()
@@ -67,7 +84,7 @@ func ExecBool(ctx ExpContext, exp string) (bool, error) {
 
 // Bool 返回布尔值
 func Bool(d *OutData, err ...error) (bool, error) {
-	if len(err) > 1 && err[0] != nil {
+	if len(err) > 0 && err[0] != nil {
 		return false, err[0]
 	}
 	return d.Bool()
@@ -76,7 +93,7 @@ func Bool(d *OutData, err ...error) (bool, error) {
 // SliceStr 返回字符串切片
 func SliceStr(d *OutData, err ...error) ([]string, error) {
 
-	if len(err) > 1 && err[0] != nil {
+	if len(err) > 0 && err[0] != nil {
 		return nil, err[0]
 	}
 	return d.SliceStr()
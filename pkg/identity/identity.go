@@ -0,0 +1,50 @@
+package identity
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("用户不存在")
+
+// User 用户
+type User struct {
+	ID         string // 用户ID
+	Name       string // 用户名称
+	Department string // 所属部门
+	Manager    string // 直属上级
+}
+
+// Provider 身份提供者，引擎创建人工任务时通过它解析候选组、上级及部门成员
+type Provider interface {
+	// 获取用户，用户不存在时返回ErrUserNotFound
+	GetUser(ctx context.Context, userID string) (*User, error)
+
+	// 获取用户组的成员
+	GroupMembers(ctx context.Context, groupID string) ([]string, error)
+
+	// 获取用户所属的用户组
+	UserGroups(ctx context.Context, userID string) ([]string, error)
+
+	// 获取部门的成员
+	DepartmentMembers(ctx context.Context, department string) ([]string, error)
+}
+
+// ManagerOf 获取用户的直属上级，没有上级时返回空字符串
+func ManagerOf(ctx context.Context, p Provider, userID string) (string, error) {
+	user, err := p.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Manager, nil
+}
+
+// DepartmentOf 获取用户所属的部门
+func DepartmentOf(ctx context.Context, p Provider, userID string) (string, error) {
+	user, err := p.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Department, nil
+}
@@ -0,0 +1,93 @@
+package identity
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Memory 基于内存的身份提供者(用于测试或用户数据较少的场景)
+type Memory struct {
+	sync.RWMutex
+	users  map[string]*User
+	groups map[string]map[string]bool
+}
+
+// NewMemory 创建基于内存的身份提供者
+func NewMemory() *Memory {
+	return &Memory{
+		users:  make(map[string]*User),
+		groups: make(map[string]map[string]bool),
+	}
+}
+
+// AddUser 增加用户，groups为用户所属的用户组，已存在的用户将被覆盖
+func (m *Memory) AddUser(user *User, groups ...string) {
+	m.Lock()
+	defer m.Unlock()
+
+	u := *user
+	m.users[u.ID] = &u
+	for _, g := range groups {
+		if m.groups[g] == nil {
+			m.groups[g] = make(map[string]bool)
+		}
+		m.groups[g][u.ID] = true
+	}
+}
+
+// GetUser 获取用户
+func (m *Memory) GetUser(ctx context.Context, userID string) (*User, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+// GroupMembers 获取用户组的成员
+func (m *Memory) GroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var ids []string
+	for id := range m.groups[groupID] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// UserGroups 获取用户所属的用户组
+func (m *Memory) UserGroups(ctx context.Context, userID string) ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var groups []string
+	for g, members := range m.groups {
+		if members[userID] {
+			groups = append(groups, g)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// DepartmentMembers 获取部门的成员
+func (m *Memory) DepartmentMembers(ctx context.Context, department string) ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var ids []string
+	for _, u := range m.users {
+		if u.Department == department {
+			ids = append(ids, u.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
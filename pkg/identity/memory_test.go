@@ -0,0 +1,35 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	m.AddUser(&User{ID: "u1", Department: "d1"}, "g1")
+	m.AddUser(&User{ID: "u2", Department: "d1", Manager: "u1"}, "g1", "g2")
+	m.AddUser(&User{ID: "u3", Department: "d2", Manager: "u1"})
+
+	ctx := context.Background()
+	if ids, _ := m.GroupMembers(ctx, "g1"); fmt.Sprint(ids) != "[u1 u2]" {
+		t.Errorf("unexpected group members: %v", ids)
+	}
+	if groups, _ := m.UserGroups(ctx, "u2"); fmt.Sprint(groups) != "[g1 g2]" {
+		t.Errorf("unexpected user groups: %v", groups)
+	}
+	if ids, _ := m.DepartmentMembers(ctx, "d1"); fmt.Sprint(ids) != "[u1 u2]" {
+		t.Errorf("unexpected department members: %v", ids)
+	}
+
+	if manager, err := ManagerOf(ctx, m, "u3"); err != nil || manager != "u1" {
+		t.Errorf("unexpected manager: %s, %v", manager, err)
+	}
+	if department, err := DepartmentOf(ctx, m, "u3"); err != nil || department != "d2" {
+		t.Errorf("unexpected department: %s, %v", department, err)
+	}
+	if _, err := m.GetUser(ctx, "u9"); err != ErrUserNotFound {
+		t.Errorf("missing user should return ErrUserNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Level 日志级别
+type Level int
+
+// 定义日志级别
+const (
+	DebugLevel Level = iota // 调试
+	InfoLevel               // 信息
+	WarnLevel               // 警告
+	ErrorLevel              // 错误
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "DEBUG"
+	case InfoLevel:
+		return "INFO"
+	case WarnLevel:
+		return "WARN"
+	case ErrorLevel:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// 定义常用的字段名称
+const (
+	FlowCodeKey       = "flow_code"        // 流程编号
+	FlowInstanceIDKey = "flow_instance_id" // 流程实例内码
+	NodeCodeKey       = "node_code"        // 节点编号
+	NodeInstanceIDKey = "node_instance_id" // 节点实例内码
+	RequestIDKey      = "request_id"       // 请求ID
+	TenantIDKey       = "tenant_id"        // 租户
+	ErrorKey          = "error"            // 错误信息
+)
+
+// Field 日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 创建日志字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err 创建错误信息字段
+func Err(err error) Field {
+	return Field{Key: ErrorKey, Value: err}
+}
+
+// Logger 日志接口
+type Logger interface {
+	// 记录日志，fields为键值对形式的附加字段
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+type fieldsKey struct{}
+
+// NewFieldsContext 创建带有日志字段的上下文，通过该上下文记录的日志都会附加这些字段
+func NewFieldsContext(ctx context.Context, fields ...Field) context.Context {
+	prev := FromFieldsContext(ctx)
+	merged := make([]Field, 0, len(prev)+len(fields))
+	merged = append(merged, prev...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FromFieldsContext 从上下文中获取日志字段
+func FromFieldsContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
+
+// Debug 记录调试日志
+func Debug(ctx context.Context, l Logger, msg string, fields ...Field) {
+	l.Log(ctx, DebugLevel, msg, fields...)
+}
+
+// Info 记录信息日志
+func Info(ctx context.Context, l Logger, msg string, fields ...Field) {
+	l.Log(ctx, InfoLevel, msg, fields...)
+}
+
+// Warn 记录警告日志
+func Warn(ctx context.Context, l Logger, msg string, fields ...Field) {
+	l.Log(ctx, WarnLevel, msg, fields...)
+}
+
+// Error 记录错误日志
+func Error(ctx context.Context, l Logger, msg string, fields ...Field) {
+	l.Log(ctx, ErrorLevel, msg, fields...)
+}
+
+type stdLogger struct {
+	mu     sync.Mutex
+	logger *log.Logger
+	level  Level
+}
+
+// New 创建以文本格式输出的日志，低于level的日志不输出
+// 格式：时间 级别 消息 key=value ...，错误字段输出错误堆栈
+func New(w io.Writer, level Level) Logger {
+	return &stdLogger{
+		logger: log.New(w, "", log.LstdFlags|log.Lmicroseconds),
+		level:  level,
+	}
+}
+
+// Default 创建输出到标准错误的日志(信息级别)
+func Default() Logger {
+	return New(os.Stderr, InfoLevel)
+}
+
+func (l *stdLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if level < l.level {
+		return
+	}
+
+	var buf strings.Builder
+	buf.WriteString(level.String())
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for _, f := range append(FromFieldsContext(ctx), fields...) {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		if err, ok := f.Value.(error); ok {
+			fmt.Fprintf(&buf, "%+v", err)
+		} else {
+			fmt.Fprintf(&buf, "%v", f.Value)
+		}
+	}
+
+	l.mu.Lock()
+	l.logger.Print(buf.String())
+	l.mu.Unlock()
+}
+
+type nopLogger struct{}
+
+// Nop 创建不输出任何内容的日志
+func Nop() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Log(context.Context, Level, string, ...Field) {}
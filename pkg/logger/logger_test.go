@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, InfoLevel)
+
+	Debug(context.Background(), l, "skipped")
+	if buf.Len() != 0 {
+		t.Fatalf("debug log should be filtered, got %q", buf.String())
+	}
+
+	ctx := NewFieldsContext(context.Background(), F(FlowCodeKey, "leave"))
+	Error(ctx, l, "handle failed", F(NodeCodeKey, "node_1"), Err(errors.New("boom")))
+
+	out := buf.String()
+	for _, s := range []string{"ERROR handle failed", "flow_code=leave", "node_code=node_1", "error=boom"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output %q should contain %q", out, s)
+		}
+	}
+}
+
+func TestFieldsContext(t *testing.T) {
+	ctx := NewFieldsContext(context.Background(), F("a", 1))
+	ctx2 := NewFieldsContext(ctx, F("b", 2))
+
+	if fields := FromFieldsContext(ctx); len(fields) != 1 {
+		t.Errorf("parent fields = %v, want 1 field", fields)
+	}
+	if fields := FromFieldsContext(ctx2); len(fields) != 2 || fields[1].Key != "b" {
+		t.Errorf("child fields = %v, want a and b", fields)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build go1.21
+// +build go1.21
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlog 创建基于log/slog的日志，logger为空时使用slog.Default()
+func NewSlog(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	slevel := slogLevel(level)
+	if !l.logger.Enabled(ctx, slevel) {
+		return
+	}
+
+	ctxFields := FromFieldsContext(ctx)
+	attrs := make([]slog.Attr, 0, len(ctxFields)+len(fields))
+	for _, f := range append(ctxFields, fields...) {
+		if err, ok := f.Value.(error); ok {
+			attrs = append(attrs, slog.String(f.Key, err.Error()))
+			continue
+		}
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	l.logger.LogAttrs(ctx, slevel, msg, attrs...)
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
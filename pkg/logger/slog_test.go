@@ -0,0 +1,30 @@
+//go:build go1.21
+// +build go1.21
+
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	Debug(context.Background(), l, "skipped")
+	Warn(NewFieldsContext(context.Background(), F(FlowInstanceIDKey, "fi_1")), l, "retry", F(NodeCodeKey, "node_1"))
+
+	out := buf.String()
+	if strings.Contains(out, "skipped") {
+		t.Errorf("debug log should be filtered, got %q", out)
+	}
+	for _, s := range []string{"level=WARN", "msg=retry", "flow_instance_id=fi_1", "node_code=node_1"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("output %q should contain %q", out, s)
+		}
+	}
+}
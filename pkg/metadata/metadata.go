@@ -0,0 +1,111 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Metadata 调用元数据，随上下文在引擎各层之间传递，并持久化到实例、定时及历史记录
+type Metadata struct {
+	TenantID   string            `json:"tenant_id,omitempty"`  // 租户
+	Flag       string            `json:"flag,omitempty"`       // 标志
+	RequestID  string            `json:"request_id,omitempty"` // 请求ID
+	Actor      string            `json:"actor,omitempty"`      // 操作人
+	Attributes map[string]string `json:"attributes,omitempty"` // 操作人属性
+}
+
+// IsEmpty 元数据是否为空
+func (m *Metadata) IsEmpty() bool {
+	return m == nil ||
+		(m.TenantID == "" && m.Flag == "" && m.RequestID == "" && m.Actor == "" && len(m.Attributes) == 0)
+}
+
+// Clone 复制元数据
+func (m *Metadata) Clone() *Metadata {
+	if m == nil {
+		return &Metadata{}
+	}
+
+	md := *m
+	if m.Attributes != nil {
+		md.Attributes = make(map[string]string, len(m.Attributes))
+		for k, v := range m.Attributes {
+			md.Attributes[k] = v
+		}
+	}
+	return &md
+}
+
+// String 返回JSON字符串形式的元数据，元数据为空时返回空字符串
+func (m *Metadata) String() string {
+	if m.IsEmpty() {
+		return ""
+	}
+
+	buf, _ := json.Marshal(m)
+	return string(buf)
+}
+
+// Parse 解析JSON字符串形式的元数据，空字符串返回空的元数据
+func Parse(s string) (*Metadata, error) {
+	md := &Metadata{}
+	if s == "" {
+		return md, nil
+	}
+
+	if err := json.Unmarshal([]byte(s), md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+type metadataKey struct{}
+
+// NewContext 创建携带元数据的上下文
+func NewContext(ctx context.Context, md *Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md.Clone())
+}
+
+// FromContext 从上下文中获取元数据的副本，不存在时返回空的元数据
+func FromContext(ctx context.Context) *Metadata {
+	md, _ := ctx.Value(metadataKey{}).(*Metadata)
+	return md.Clone()
+}
+
+// Encode 返回上下文中JSON字符串形式的元数据
+func Encode(ctx context.Context) string {
+	md, _ := ctx.Value(metadataKey{}).(*Metadata)
+	return md.String()
+}
+
+// WithTenant 创建携带租户的上下文
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	md := FromContext(ctx)
+	md.TenantID = tenantID
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// WithFlag 创建携带标志的上下文
+func WithFlag(ctx context.Context, flag string) context.Context {
+	md := FromContext(ctx)
+	md.Flag = flag
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// WithRequestID 创建携带请求ID的上下文
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	md := FromContext(ctx)
+	md.RequestID = requestID
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// WithActor 创建携带操作人及其属性的上下文
+func WithActor(ctx context.Context, actor string, attributes map[string]string) context.Context {
+	md := FromContext(ctx)
+	md.Actor = actor
+	md.Attributes = make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		md.Attributes[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, md)
+}
@@ -0,0 +1,55 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if !FromContext(ctx).IsEmpty() || Encode(ctx) != "" {
+		t.Error("metadata should be empty")
+	}
+
+	ctx = WithTenant(ctx, "t1")
+	ctx = WithFlag(ctx, "f1")
+	ctx = WithRequestID(ctx, "r1")
+	attrs := map[string]string{"dept": "d1"}
+	child := WithActor(ctx, "u1", attrs)
+	attrs["dept"] = "d2"
+
+	md := FromContext(child)
+	if md.TenantID != "t1" || md.Flag != "f1" || md.RequestID != "r1" || md.Actor != "u1" || md.Attributes["dept"] != "d1" {
+		t.Errorf("unexpected metadata: %+v", md)
+	}
+
+	if FromContext(ctx).Actor != "" {
+		t.Error("parent context should not be modified")
+	}
+
+	md.Attributes["dept"] = "d3"
+	if FromContext(child).Attributes["dept"] != "d1" {
+		t.Error("metadata from context should be a copy")
+	}
+}
+
+func TestParse(t *testing.T) {
+	ctx := NewContext(context.Background(), &Metadata{TenantID: "t1", Attributes: map[string]string{"k": "v"}})
+
+	md, err := Parse(Encode(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.TenantID != "t1" || md.Attributes["k"] != "v" {
+		t.Errorf("unexpected metadata: %+v", md)
+	}
+
+	md, err = Parse("")
+	if err != nil || !md.IsEmpty() {
+		t.Error("empty string should parse to empty metadata", err)
+	}
+
+	if _, err = Parse("{"); err == nil {
+		t.Error("invalid json should return error")
+	}
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import "time"
+
+// TodoCount 节点的待办数量
+type TodoCount struct {
+	FlowCode string // 流程编号
+	NodeCode string // 节点编号
+	Count    int64  // 待办数量
+}
+
+// Collector 指标收集器
+type Collector interface {
+	// 流程实例已发起
+	FlowStarted(flowCode string)
+	// 流程实例已完成
+	FlowCompleted(flowCode string)
+	// 流程实例已停止
+	FlowStopped(flowCode string)
+	// 节点实例已完成，dwell为节点实例从创建到完成的停留时长
+	NodeCompleted(flowCode, nodeCode string, dwell time.Duration)
+	// 表达式已执行，kind为表达式类型(路由条件、指派人)
+	ExpressionEvaluated(kind string, duration time.Duration, err error)
+	// 设定当前所有节点的待办数量(未包含的节点视为没有待办)
+	SetTodoCounts(counts []*TodoCount)
+	// 设定当前已到期未处理的节点定时数量
+	SetTimerBacklog(count int64)
+}
+
+type nopCollector struct{}
+
+// Nop 创建不收集任何指标的收集器
+func Nop() Collector {
+	return nopCollector{}
+}
+
+func (nopCollector) FlowStarted(string)                               {}
+func (nopCollector) FlowCompleted(string)                             {}
+func (nopCollector) FlowStopped(string)                               {}
+func (nopCollector) NodeCompleted(string, string, time.Duration)      {}
+func (nopCollector) ExpressionEvaluated(string, time.Duration, error) {}
+func (nopCollector) SetTodoCounts([]*TodoCount)                       {}
+func (nopCollector) SetTimerBacklog(int64)                            {}
@@ -0,0 +1,163 @@
+package prom
+
+import (
+	"time"
+
+	"github.com/chapin666/kitten/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type options struct {
+	namespace string
+	buckets   []float64
+}
+
+// Option 配置项
+type Option func(*options)
+
+// SetNamespace 设定指标的命名空间，默认为kitten
+func SetNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// SetBuckets 设定节点停留时长的直方图分桶(秒)
+func SetBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// Collector 基于Prometheus的指标收集器
+// 同时实现了prometheus.Collector接口，可以注册到调用方的Registry
+type Collector struct {
+	flowStarted   *prometheus.CounterVec
+	flowCompleted *prometheus.CounterVec
+	flowStopped   *prometheus.CounterVec
+	nodeDwell     *prometheus.HistogramVec
+	expDuration   *prometheus.HistogramVec
+	expErrors     *prometheus.CounterVec
+	todoCount     *prometheus.GaugeVec
+	timerBacklog  prometheus.Gauge
+	collectors    []prometheus.Collector
+}
+
+var _ metrics.Collector = (*Collector)(nil)
+
+// New 创建Prometheus指标收集器
+func New(opts ...Option) *Collector {
+	o := &options{
+		namespace: "kitten",
+		// 1分钟到7天
+		buckets: []float64{60, 300, 1800, 3600, 4 * 3600, 8 * 3600, 24 * 3600, 3 * 24 * 3600, 7 * 24 * 3600},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := &Collector{
+		flowStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "flow_started_total",
+			Help:      "发起的流程实例数量",
+		}, []string{"flow_code"}),
+		flowCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "flow_completed_total",
+			Help:      "完成的流程实例数量",
+		}, []string{"flow_code"}),
+		flowStopped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "flow_stopped_total",
+			Help:      "停止的流程实例数量",
+		}, []string{"flow_code"}),
+		nodeDwell: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Name:      "node_dwell_seconds",
+			Help:      "节点实例从创建到完成的停留时长",
+			Buckets:   o.buckets,
+		}, []string{"flow_code", "node_code"}),
+		expDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Name:      "expression_duration_seconds",
+			Help:      "表达式的执行耗时",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}, []string{"kind"}),
+		expErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "expression_errors_total",
+			Help:      "表达式执行错误的数量",
+		}, []string{"kind"}),
+		todoCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: o.namespace,
+			Name:      "todo_count",
+			Help:      "节点的待办数量",
+		}, []string{"flow_code", "node_code"}),
+		timerBacklog: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: o.namespace,
+			Name:      "timer_backlog",
+			Help:      "已到期未处理的节点定时数量",
+		}),
+	}
+	c.collectors = []prometheus.Collector{
+		c.flowStarted, c.flowCompleted, c.flowStopped, c.nodeDwell,
+		c.expDuration, c.expErrors, c.todoCount, c.timerBacklog,
+	}
+	return c
+}
+
+// Describe prometheus.Collector 接口实现
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, item := range c.collectors {
+		item.Describe(ch)
+	}
+}
+
+// Collect prometheus.Collector 接口实现
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, item := range c.collectors {
+		item.Collect(ch)
+	}
+}
+
+// FlowStarted 流程实例已发起
+func (c *Collector) FlowStarted(flowCode string) {
+	c.flowStarted.WithLabelValues(flowCode).Inc()
+}
+
+// FlowCompleted 流程实例已完成
+func (c *Collector) FlowCompleted(flowCode string) {
+	c.flowCompleted.WithLabelValues(flowCode).Inc()
+}
+
+// FlowStopped 流程实例已停止
+func (c *Collector) FlowStopped(flowCode string) {
+	c.flowStopped.WithLabelValues(flowCode).Inc()
+}
+
+// NodeCompleted 节点实例已完成
+func (c *Collector) NodeCompleted(flowCode, nodeCode string, dwell time.Duration) {
+	c.nodeDwell.WithLabelValues(flowCode, nodeCode).Observe(dwell.Seconds())
+}
+
+// ExpressionEvaluated 表达式已执行
+func (c *Collector) ExpressionEvaluated(kind string, duration time.Duration, err error) {
+	c.expDuration.WithLabelValues(kind).Observe(duration.Seconds())
+	if err != nil {
+		c.expErrors.WithLabelValues(kind).Inc()
+	}
+}
+
+// SetTodoCounts 设定当前所有节点的待办数量
+func (c *Collector) SetTodoCounts(counts []*metrics.TodoCount) {
+	c.todoCount.Reset()
+	for _, item := range counts {
+		c.todoCount.WithLabelValues(item.FlowCode, item.NodeCode).Set(float64(item.Count))
+	}
+}
+
+// SetTimerBacklog 设定当前已到期未处理的节点定时数量
+func (c *Collector) SetTimerBacklog(count int64) {
+	c.timerBacklog.Set(float64(count))
+}
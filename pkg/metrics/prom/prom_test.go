@@ -0,0 +1,49 @@
+package prom
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chapin666/kitten/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := New(SetNamespace("test"))
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("register collector failed: %s", err.Error())
+	}
+
+	c.FlowStarted("leave")
+	c.FlowStarted("leave")
+	c.FlowCompleted("leave")
+	c.NodeCompleted("leave", "node_1", time.Minute)
+	c.ExpressionEvaluated("condition", time.Millisecond, errors.New("failed"))
+	c.SetTodoCounts([]*metrics.TodoCount{{FlowCode: "leave", NodeCode: "node_1", Count: 3}})
+	c.SetTodoCounts([]*metrics.TodoCount{{FlowCode: "leave", NodeCode: "node_2", Count: 1}})
+	c.SetTimerBacklog(5)
+
+	if v := testutil.ToFloat64(c.flowStarted.WithLabelValues("leave")); v != 2 {
+		t.Errorf("flow started = %v, want 2", v)
+	}
+	if v := testutil.ToFloat64(c.expErrors.WithLabelValues("condition")); v != 1 {
+		t.Errorf("expression errors = %v, want 1", v)
+	}
+	if n := testutil.CollectAndCount(c.todoCount); n != 1 {
+		t.Errorf("todo count series = %d, want 1 after reset", n)
+	}
+	if v := testutil.ToFloat64(c.timerBacklog); v != 5 {
+		t.Errorf("timer backlog = %v, want 5", v)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %s", err.Error())
+	}
+	if len(families) == 0 || families[0].GetName()[:5] != "test_" {
+		t.Errorf("metrics should use the configured namespace")
+	}
+}
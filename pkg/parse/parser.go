@@ -13,11 +13,15 @@ type Parser interface {
 
 // ParseResult 流程数据
 type ParseResult struct {
-	FlowID      string        // 流程ID
-	FlowName    string        // 流程名称
-	FlowVersion int64         // 流程版本号
-	FlowStatus  int           // 流程状态(1:可用 2:不可用)
-	Nodes       []*NodeResult // 节点数据
+	FlowID      string            // 流程ID
+	FlowName    string            // 流程名称
+	FlowVersion int64             // 流程版本号
+	FlowStatus  int               // 流程状态(1:可用 2:不可用)
+	Properties  []*PropertyResult // 流程属性
+	Nodes       []*NodeResult     // 节点数据
+
+	CandidateStarterUsers  []string // 可发起流程的用户(potentialStarter)
+	CandidateStarterGroups []string // 可发起流程的用户组(potentialStarter)
 }
 
 // NodeResult 节点数据
@@ -28,7 +32,10 @@ type NodeResult struct {
 	Routers              []*RouterResult   // 节点路由
 	Properties           []*PropertyResult // 节点属性
 	CandidateExpressions []string          // 候选人表达式
+	CandidateGroups      []string          // 候选组
 	FormResult           *NodeFormResult   // 节点表单
+	AsyncBefore          bool              // 进入节点前异步执行
+	AsyncAfter           bool              // 完成节点后异步流转
 }
 
 // RouterResult 节点路由数据
@@ -3,13 +3,16 @@ package xml
 import "github.com/chapin666/kitten/pkg/parse"
 
 type nodeInfo struct {
-	ProcessCode    string
-	Type           string
-	Code           string
-	Name           string
-	CandidateUsers []string
-	Properties     []*parse.PropertyResult
-	FormResult     *parse.NodeFormResult
+	ProcessCode     string
+	Type            string
+	Code            string
+	Name            string
+	CandidateUsers  []string
+	CandidateGroups []string
+	Properties      []*parse.PropertyResult
+	FormResult      *parse.NodeFormResult
+	AsyncBefore     bool
+	AsyncAfter      bool
 }
 
 type sequenceFlow struct {
@@ -21,4 +24,3 @@ type sequenceFlow struct {
 	Explain     string
 	Expression  string
 }
-
@@ -3,6 +3,7 @@ package xml
 import (
 	"context"
 	"strconv"
+	"strings"
 
 	"github.com/chapin666/kitten/pkg/parse"
 	"github.com/chapin666/kitten/pkg/types"
@@ -64,7 +65,12 @@ func (p *xmlParser) Parse(ctx context.Context, content []byte) (*parse.ParseResu
 			return nil, err
 		}
 	}
-
+	// process extensionElements properties
+	if extensionElements := process.SelectElement("extensionElements"); extensionElements != nil {
+		result.Properties = p.ParsePropertyResults(extensionElements)
+	}
+	// 可发起人(potentialStarter、camunda:candidateStarterUsers、camunda:candidateStarterGroups)
+	p.ParsePotentialStarter(process, result)
 
 	// 解析节点
 	// 定义一个用于辅助的 map，由节点 id 映射到 NodeResult
@@ -73,6 +79,7 @@ func (p *xmlParser) Parse(ctx context.Context, content []byte) (*parse.ParseResu
 	for _, element := range process.ChildElements() {
 		if element.Tag == "documentation" ||
 			element.Tag == "extensionElements" ||
+			element.Tag == "potentialStarter" ||
 			element.Tag == "sequenceFlow" {
 			continue
 		}
@@ -85,8 +92,11 @@ func (p *xmlParser) Parse(ctx context.Context, content []byte) (*parse.ParseResu
 			return nil, err
 		}
 		nodeResult.CandidateExpressions = node.CandidateUsers
+		nodeResult.CandidateGroups = node.CandidateGroups
 		nodeResult.FormResult = node.FormResult
 		nodeResult.Properties = node.Properties
+		nodeResult.AsyncBefore = node.AsyncBefore
+		nodeResult.AsyncAfter = node.AsyncAfter
 		nodeMap[nodeResult.NodeID] = &nodeResult
 		// 如果节点是一个路由的话，需要特殊处理
 	}
@@ -132,6 +142,16 @@ func (p *xmlParser) ParseNode(element *etree.Element) (*nodeInfo, error) {
 	if candidateUsers := element.SelectAttr("candidateUsers"); candidateUsers != nil {
 		node.CandidateUsers = []string{candidateUsers.Value}
 	}
+	if candidateGroups := element.SelectAttr("candidateGroups"); candidateGroups != nil {
+		node.CandidateGroups = splitNames(candidateGroups.Value)
+	}
+	// 异步延续标记(camunda:asyncBefore、camunda:asyncAfter)
+	if v := element.SelectAttr("asyncBefore"); v != nil {
+		node.AsyncBefore, _ = strconv.ParseBool(v.Value)
+	}
+	if v := element.SelectAttr("asyncAfter"); v != nil {
+		node.AsyncAfter, _ = strconv.ParseBool(v.Value)
+	}
 
 	nodeFormResult := new(parse.NodeFormResult)
 	if formKey := element.SelectAttr("formKey"); formKey != nil {
@@ -149,27 +169,81 @@ func (p *xmlParser) ParseNode(element *etree.Element) (*nodeInfo, error) {
 			}
 		}
 
-		if propertyData := extensionElements.SelectElement("properties"); propertyData != nil {
-			// 解析节点属性
-			for _, p := range propertyData.SelectElements("property") {
-				var item parse.PropertyResult
-				if name := p.SelectAttr("name"); name != nil {
-					item.Name = name.Value
-				}
-				if value := p.SelectAttr("value"); value != nil {
-					item.Value = value.Value
-				}
-				if item.Name != "" {
-					node.Properties = append(node.Properties, &item)
-				}
-			}
-		}
+		// 解析节点属性
+		node.Properties = p.ParsePropertyResults(extensionElements)
 	}
 	node.FormResult = nodeFormResult
 
 	return &node, nil
 }
 
+// ParsePropertyResults 解析extensionElements中的属性(camunda:properties)
+func (p *xmlParser) ParsePropertyResults(extensionElements *etree.Element) []*parse.PropertyResult {
+	propertyData := extensionElements.SelectElement("properties")
+	if propertyData == nil {
+		return nil
+	}
+
+	var properties []*parse.PropertyResult
+	for _, e := range propertyData.SelectElements("property") {
+		var item parse.PropertyResult
+		if name := e.SelectAttr("name"); name != nil {
+			item.Name = name.Value
+		}
+		if value := e.SelectAttr("value"); value != nil {
+			item.Value = value.Value
+		}
+		if item.Name != "" {
+			properties = append(properties, &item)
+		}
+	}
+	return properties
+}
+
+// ParsePotentialStarter 解析流程的可发起人
+// potentialStarter的表达式格式为 user(u1), group(g1), g2，未指定类型时作为用户组
+func (p *xmlParser) ParsePotentialStarter(process *etree.Element, result *parse.ParseResult) {
+	if v := process.SelectAttr("candidateStarterUsers"); v != nil {
+		result.CandidateStarterUsers = append(result.CandidateStarterUsers, splitNames(v.Value)...)
+	}
+	if v := process.SelectAttr("candidateStarterGroups"); v != nil {
+		result.CandidateStarterGroups = append(result.CandidateStarterGroups, splitNames(v.Value)...)
+	}
+
+	for _, starter := range process.SelectElements("potentialStarter") {
+		assignment := starter.SelectElement("resourceAssignmentExpression")
+		if assignment == nil {
+			continue
+		}
+		expression := assignment.SelectElement("formalExpression")
+		if expression == nil {
+			continue
+		}
+
+		for _, name := range splitNames(expression.Text()) {
+			switch {
+			case strings.HasPrefix(name, "user(") && strings.HasSuffix(name, ")"):
+				result.CandidateStarterUsers = append(result.CandidateStarterUsers, strings.TrimSpace(name[5:len(name)-1]))
+			case strings.HasPrefix(name, "group(") && strings.HasSuffix(name, ")"):
+				result.CandidateStarterGroups = append(result.CandidateStarterGroups, strings.TrimSpace(name[6:len(name)-1]))
+			default:
+				result.CandidateStarterGroups = append(result.CandidateStarterGroups, name)
+			}
+		}
+	}
+}
+
+// 拆分逗号分隔的名称列表
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func (p *xmlParser) ParseSequenceFlow(element *etree.Element) (*sequenceFlow, error) {
 	hasExpression := false
 	var seq sequenceFlow
@@ -35,3 +35,83 @@ func TestParseFormBpmn(t *testing.T) {
 	buf, _ := json.Marshal(v)
 	fmt.Println(string(buf))
 }
+
+func TestParseAsyncContinuation(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:camunda="http://camunda.org/schema/1.0/bpmn">
+  <bpmn:process id="process_async" isExecutable="true">
+    <bpmn:startEvent id="node_start" />
+    <bpmn:exclusiveGateway id="node_gateway" camunda:asyncBefore="true" camunda:asyncAfter="true" />
+    <bpmn:endEvent id="node_end" />
+    <bpmn:sequenceFlow id="flow_1" sourceRef="node_start" targetRef="node_gateway" />
+    <bpmn:sequenceFlow id="flow_2" sourceRef="node_gateway" targetRef="node_end" />
+  </bpmn:process>
+</definitions>`)
+
+	v, err := NewXMLParser().Parse(context.Background(), data)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+
+	for _, node := range v.Nodes {
+		async := node.NodeID == "node_gateway"
+		if node.AsyncBefore != async || node.AsyncAfter != async {
+			t.Errorf("node %s async = (%v, %v), want (%v, %v)", node.NodeID, node.AsyncBefore, node.AsyncAfter, async, async)
+		}
+	}
+}
+
+func TestParsePotentialStarter(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:camunda="http://camunda.org/schema/1.0/bpmn">
+  <bpmn:process id="process_starter" isExecutable="true" camunda:candidateStarterUsers="u1, u2" camunda:candidateStarterGroups="g1">
+    <bpmn:potentialStarter>
+      <bpmn:resourceAssignmentExpression>
+        <bpmn:formalExpression>user(u3), group(g2), g3</bpmn:formalExpression>
+      </bpmn:resourceAssignmentExpression>
+    </bpmn:potentialStarter>
+    <bpmn:startEvent id="node_start" />
+    <bpmn:endEvent id="node_end" />
+    <bpmn:sequenceFlow id="flow_1" sourceRef="node_start" targetRef="node_end" />
+  </bpmn:process>
+</definitions>`)
+
+	v, err := NewXMLParser().Parse(context.Background(), data)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+
+	if fmt.Sprint(v.CandidateStarterUsers) != "[u1 u2 u3]" {
+		t.Errorf("unexpected starter users: %v", v.CandidateStarterUsers)
+	}
+	if fmt.Sprint(v.CandidateStarterGroups) != "[g1 g2 g3]" {
+		t.Errorf("unexpected starter groups: %v", v.CandidateStarterGroups)
+	}
+	if len(v.Nodes) != 2 {
+		t.Errorf("potentialStarter should not be parsed as a node, got %d nodes", len(v.Nodes))
+	}
+}
+
+func TestParseCandidateGroups(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:camunda="http://camunda.org/schema/1.0/bpmn">
+  <bpmn:process id="process_groups" isExecutable="true">
+    <bpmn:startEvent id="node_start" />
+    <bpmn:userTask id="node_audit" camunda:candidateGroups="hr, finance" />
+    <bpmn:endEvent id="node_end" />
+    <bpmn:sequenceFlow id="flow_1" sourceRef="node_start" targetRef="node_audit" />
+    <bpmn:sequenceFlow id="flow_2" sourceRef="node_audit" targetRef="node_end" />
+  </bpmn:process>
+</definitions>`)
+
+	v, err := NewXMLParser().Parse(context.Background(), data)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err.Error())
+	}
+
+	for _, node := range v.Nodes {
+		if node.NodeID == "node_audit" && fmt.Sprint(node.CandidateGroups) != "[hr finance]" {
+			t.Errorf("unexpected candidate groups: %v", node.CandidateGroups)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package publisher
+
+import (
+	"context"
+)
+
+type chanPublisher struct {
+	ch chan<- *Message
+}
+
+// NewChanPublisher 进程内的通道消息发布者，通道已满时阻塞直到消息被接收或ctx结束
+func NewChanPublisher(ch chan<- *Message) Publisher {
+	return &chanPublisher{ch: ch}
+}
+
+func (p *chanPublisher) Publish(ctx context.Context, msg *Message) error {
+	select {
+	case p.ch <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,94 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type httpOptions struct {
+	client  *http.Client
+	timeout time.Duration
+	header  http.Header
+}
+
+// HTTPOption HTTP消息发布者配置
+type HTTPOption func(*httpOptions)
+
+// SetHTTPClient 设定HTTP客户端
+func SetHTTPClient(client *http.Client) HTTPOption {
+	return func(o *httpOptions) {
+		o.client = client
+	}
+}
+
+// SetHTTPTimeout 设定每次请求的超时时间
+func SetHTTPTimeout(timeout time.Duration) HTTPOption {
+	return func(o *httpOptions) {
+		o.timeout = timeout
+	}
+}
+
+// SetHTTPHeader 设定请求附带的头部信息
+func SetHTTPHeader(key, value string) HTTPOption {
+	return func(o *httpOptions) {
+		o.header.Add(key, value)
+	}
+}
+
+type httpPublisher struct {
+	url  string
+	opts *httpOptions
+}
+
+// NewHTTPPublisher HTTP消息发布者，以POST请求将消息内容发送到url
+// 消息ID及主题分别通过X-Kitten-Message-ID及X-Kitten-Topic头部传递，响应状态码不是2xx时返回错误
+func NewHTTPPublisher(url string, options ...HTTPOption) Publisher {
+	opts := &httpOptions{
+		client:  http.DefaultClient,
+		timeout: 10 * time.Second,
+		header:  make(http.Header),
+	}
+	for _, opt := range options {
+		opt(opts)
+	}
+
+	return &httpPublisher{url: url, opts: opts}
+}
+
+func (p *httpPublisher) Publish(ctx context.Context, msg *Message) error {
+	if p.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.opts.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range p.opts.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Kitten-Message-ID", msg.ID)
+	req.Header.Set("X-Kitten-Topic", msg.Topic)
+
+	resp, err := p.opts.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("发布消息[%s]失败，响应状态码：%d", msg.ID, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package publisher
+
+import (
+	"context"
+)
+
+// Message 发布的消息
+type Message struct {
+	ID      string `json:"id"`      // 消息ID(重复投递时保持不变，接收方可以据此去重)
+	Topic   string `json:"topic"`   // 消息主题
+	Payload []byte `json:"payload"` // 消息内容
+	Created int64  `json:"created"` // 创建时间戳
+}
+
+// Publisher 消息发布者
+type Publisher interface {
+	// 发布消息，返回错误时消息会被重新投递
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublishFunc 使用函数实现消息发布者
+type PublishFunc func(ctx context.Context, msg *Message) error
+
+// Publish 发布消息
+func (f PublishFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
@@ -0,0 +1,60 @@
+package publisher
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChanPublisher(t *testing.T) {
+	ch := make(chan *Message, 1)
+	p := NewChanPublisher(ch)
+
+	err := p.Publish(context.Background(), &Message{ID: "1", Topic: "flow_started"})
+	if err != nil {
+		t.Fatalf("publish failed: %s", err.Error())
+	}
+	if msg := <-ch; msg.ID != "1" {
+		t.Errorf("msg.ID = %s, want 1", msg.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch <- &Message{}
+	if err := p.Publish(ctx, &Message{ID: "2"}); err == nil {
+		t.Error("publish to full channel with canceled context should fail")
+	}
+}
+
+func TestHTTPPublisher(t *testing.T) {
+	var (
+		gotID, gotTopic, gotToken string
+		gotBody                   []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get("X-Kitten-Message-ID")
+		gotTopic = r.Header.Get("X-Kitten-Topic")
+		gotToken = r.Header.Get("Authorization")
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		if gotTopic == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPublisher(srv.URL, SetHTTPHeader("Authorization", "Bearer token"))
+	err := p.Publish(context.Background(), &Message{ID: "1", Topic: "flow_ended", Payload: []byte(`{"a":1}`)})
+	if err != nil {
+		t.Fatalf("publish failed: %s", err.Error())
+	}
+	if gotID != "1" || gotTopic != "flow_ended" || gotToken != "Bearer token" || string(gotBody) != `{"a":1}` {
+		t.Errorf("request = (%s, %s, %s, %s)", gotID, gotTopic, gotToken, gotBody)
+	}
+
+	err = p.Publish(context.Background(), &Message{ID: "2", Topic: "fail"})
+	if err == nil {
+		t.Error("publish with error status should fail")
+	}
+}
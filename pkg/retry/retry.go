@@ -80,3 +80,18 @@ LBBEGIN:
 
 	return nil
 }
+
+// Backoff exponential backoff sleep function,
+// the interval starts at base and doubles on each attempt, up to max
+func Backoff(base, max time.Duration) Sleep {
+	return func(i int) time.Duration {
+		d := base
+		for n := 1; n < i && d < max; n++ {
+			d *= 2
+		}
+		if max > 0 && d > max {
+			d = max
+		}
+		return d
+	}
+}
@@ -81,3 +81,13 @@ func TestDo(t *testing.T) {
 		t.Error("exceeded retry limit", err)
 	}
 }
+
+func TestBackoff(t *testing.T) {
+	sleep := Backoff(time.Second, 10*time.Second)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, d := range want {
+		if v := sleep(i + 1); v != d {
+			t.Errorf("sleep(%d) = %s, want %s", i+1, v, d)
+		}
+	}
+}
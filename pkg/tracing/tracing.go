@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName 追踪的仪表名称
+const InstrumentationName = "github.com/chapin666/kitten"
+
+// 定义span的属性名称
+const (
+	FlowCodeKey       = attribute.Key("kitten.flow_code")        // 流程编号
+	FlowInstanceIDKey = attribute.Key("kitten.flow_instance_id") // 流程实例内码
+	NodeCodeKey       = attribute.Key("kitten.node_code")        // 节点编号
+	NodeTypeKey       = attribute.Key("kitten.node_type")        // 节点类型
+	NodeInstanceIDKey = attribute.Key("kitten.node_instance_id") // 节点实例内码
+	UserIDKey         = attribute.Key("kitten.user_id")          // 操作人
+	ExpressionKey     = attribute.Key("kitten.expression")       // 表达式
+	DBStatementKey    = attribute.Key("db.statement")            // SQL语句
+	DBSystemKey       = attribute.Key("db.system")               // 数据库类型
+)
+
+// Tracer 获取追踪器，上下文中存在span时使用该span的TracerProvider，否则使用全局的TracerProvider
+func Tracer(ctx context.Context) trace.Tracer {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		return span.TracerProvider().Tracer(InstrumentationName)
+	}
+	return otel.GetTracerProvider().Tracer(InstrumentationName)
+}
+
+// Start 创建span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer(ctx).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// HasSpan 检查上下文中是否存在有效的span
+func HasSpan(ctx context.Context) bool {
+	return trace.SpanFromContext(ctx).SpanContext().IsValid()
+}
+
+// End 结束span，err不为空时记录错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartWithParent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if !HasSpan(ctx) {
+		t.Fatal("context should have a span")
+	}
+
+	_, child := Start(ctx, "child", NodeCodeKey.String("node_1"))
+	End(child, errors.New("failed"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ended spans = %d, want 2", len(spans))
+	}
+	if spans[0].Name() != "child" || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("child span should use the parent's tracer provider")
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("child span status = %v, want error", spans[0].Status().Code)
+	}
+}
+
+func TestStartWithoutParent(t *testing.T) {
+	if HasSpan(context.Background()) {
+		t.Fatal("background context should not have a span")
+	}
+	_, span := Start(context.Background(), "noop")
+	End(span, nil)
+}
@@ -0,0 +1,204 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chapin666/kitten/pkg/retry"
+)
+
+// 定义请求头
+const (
+	HeaderEvent     = "X-Kitten-Event"     // 事件类型
+	HeaderDelivery  = "X-Kitten-Delivery"  // 通知ID(重试时保持不变)
+	HeaderTimestamp = "X-Kitten-Timestamp" // 签名时间戳(秒)
+	HeaderSignature = "X-Kitten-Signature" // 签名(sha256=HMAC-SHA256(secret, timestamp.body)的十六进制)
+)
+
+// ErrDeadLetter 通知投递失败并已保存到死信存储
+var ErrDeadLetter = errors.New("通知投递失败，已保存到死信")
+
+// DeadLetter 超过重试次数仍投递失败的通知
+type DeadLetter struct {
+	URL          string // 通知地址
+	Event        string // 事件类型
+	DeliveryID   string // 通知ID
+	Payload      []byte // 通知内容
+	Attempts     int    // 投递次数
+	ErrorMessage string // 最后一次的错误信息
+	Created      int64  // 创建时间戳
+}
+
+// DeadLetterStore 死信存储
+type DeadLetterStore interface {
+	// 保存投递失败的通知
+	SaveDeadLetter(ctx context.Context, item *DeadLetter) error
+}
+
+type options struct {
+	client     *http.Client
+	secret     []byte
+	timeout    time.Duration
+	retries    int
+	sleep      retry.Sleep
+	deadLetter DeadLetterStore
+}
+
+// Option 通知配置
+type Option func(*options)
+
+// SetSecret 设定签名密钥
+func SetSecret(secret string) Option {
+	return func(o *options) {
+		o.secret = []byte(secret)
+	}
+}
+
+// SetClient 设定HTTP客户端
+func SetClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// SetTimeout 设定每次请求的超时时间
+func SetTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// SetRetries 设定投递次数及重试间隔
+func SetRetries(retries int, sleep retry.Sleep) Option {
+	return func(o *options) {
+		o.retries = retries
+		o.sleep = sleep
+	}
+}
+
+// SetDeadLetterStore 设定死信存储
+func SetDeadLetterStore(store DeadLetterStore) Option {
+	return func(o *options) {
+		o.deadLetter = store
+	}
+}
+
+// Notifier HTTP webhook通知
+type Notifier struct {
+	opts *options
+}
+
+// New 创建webhook通知
+func New(opts ...Option) *Notifier {
+	o := &options{
+		client:  http.DefaultClient,
+		timeout: 10 * time.Second,
+		retries: 3,
+		sleep:   retry.Backoff(time.Second, 30*time.Second),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.retries < 1 {
+		o.retries = 1
+	}
+	return &Notifier{opts: o}
+}
+
+// Notify 以POST请求发送签名的通知内容，失败时按设定的次数重试，仍失败时保存到死信存储并返回错误
+// 已保存到死信存储时返回的错误可以通过errors.Is(err, ErrDeadLetter)判断
+func (n *Notifier) Notify(ctx context.Context, url, event, deliveryID string, payload []byte) error {
+	var (
+		attempts int
+		lastErr  error
+	)
+
+	err := retry.DoFunc(n.opts.retries, func() error {
+		attempts++
+		lastErr = n.send(ctx, url, event, deliveryID, payload)
+		if lastErr != nil && ctx.Err() != nil {
+			// 上下文已结束不再重试
+			return nil
+		}
+		return lastErr
+	}, n.opts.sleep)
+	if err == nil && lastErr == nil {
+		return nil
+	}
+
+	if n.opts.deadLetter != nil {
+		item := &DeadLetter{
+			URL:          url,
+			Event:        event,
+			DeliveryID:   deliveryID,
+			Payload:      payload,
+			Attempts:     attempts,
+			ErrorMessage: lastErr.Error(),
+			Created:      time.Now().Unix(),
+		}
+		if serr := n.opts.deadLetter.SaveDeadLetter(ctx, item); serr != nil {
+			return fmt.Errorf("保存死信发生错误：%s，投递错误：%s", serr.Error(), lastErr.Error())
+		}
+		return fmt.Errorf("%w：%s", ErrDeadLetter, lastErr.Error())
+	}
+	return lastErr
+}
+
+func (n *Notifier) send(ctx context.Context, url, event, deliveryID string, payload []byte) error {
+	if n.opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.opts.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if len(n.opts.secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(n.opts.secret, timestamp, payload))
+	}
+
+	resp, err := n.opts.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("通知[%s]失败，响应状态码：%d", deliveryID, resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign 计算通知签名
+func Sign(secret []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验通知签名，供接收方使用
+func Verify(secret []byte, timestamp string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	items []*DeadLetter
+}
+
+func (s *memoryStore) SaveDeadLetter(ctx context.Context, item *DeadLetter) error {
+	s.items = append(s.items, item)
+	return nil
+}
+
+func noSleep(i int) time.Duration {
+	return 0
+}
+
+func TestNotify(t *testing.T) {
+	secret := "secret"
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !Verify([]byte(secret), r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			t.Error("invalid signature")
+		}
+		if r.Header.Get(HeaderEvent) != "task_assigned" || r.Header.Get(HeaderDelivery) != "d1" {
+			t.Errorf("headers = %v", r.Header)
+		}
+
+		// 第一次请求失败，重试后成功
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	store := new(memoryStore)
+	n := New(SetSecret(secret), SetRetries(3, noSleep), SetDeadLetterStore(store))
+	err := n.Notify(context.Background(), srv.URL, "task_assigned", "d1", []byte(`{"type":"task_assigned"}`))
+	if err != nil {
+		t.Fatalf("notify failed: %s", err.Error())
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+	if len(store.items) != 0 {
+		t.Errorf("dead letters = %d, want 0", len(store.items))
+	}
+}
+
+func TestNotifyDeadLetter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	store := new(memoryStore)
+	n := New(SetTimeout(10*time.Millisecond), SetRetries(2, noSleep), SetDeadLetterStore(store))
+	err := n.Notify(context.Background(), srv.URL, "flow_ended", "d2", []byte(`{}`))
+	if !errors.Is(err, ErrDeadLetter) {
+		t.Fatalf("notify with timeout = %v, want ErrDeadLetter", err)
+	}
+	if len(store.items) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(store.items))
+	}
+	if item := store.items[0]; item.DeliveryID != "d2" || item.Attempts != 2 || item.ErrorMessage == "" {
+		t.Errorf("dead letter = %#v", item)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	payload := []byte(`{"a":1}`)
+	sign := Sign([]byte("k"), "100", payload)
+	if !Verify([]byte("k"), "100", payload, sign) {
+		t.Error("Verify(valid signature) = false")
+	}
+	if Verify([]byte("k"), "101", payload, sign) {
+		t.Error("Verify(other timestamp) = true")
+	}
+}
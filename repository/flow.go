@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/chapin666/kitten/model"
@@ -14,54 +15,48 @@ type Flow struct {
 	DB *db.DB `inject:""`
 }
 
-// CreateFlow 创建流程数据
-func (f *Flow) CreateFlow(flow *model.Flow, nodes *model.NodeOperating, forms *model.FormOperating) error {
-	tran, err := f.DB.Begin()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程基础数据开启事物发生错误")
-	}
-
-	// 写入数据到flow表
-	err = tran.Insert(flow)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "插入流程数据发生错误")
-	}
+// ExecTrans 在事务中执行函数，上下文中的事务会传递给仓储的各个方法
+func (f *Flow) ExecTrans(ctx context.Context, fn func(context.Context) error) error {
+	return f.DB.ExecTrans(ctx, fn)
+}
 
-	// 写入数据到 NodeGroup、RouterGroup、AssignmentGroup、PropertyGroup
-	if list := nodes.All(); len(list) > 0 {
-		err = tran.Insert(list...)
+// CreateFlow 创建流程数据
+func (f *Flow) CreateFlow(ctx context.Context, flow *model.Flow, nodes *model.NodeOperating, forms *model.FormOperating) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		// 写入数据到flow表
+		err := f.DB.InsertContext(ctx, flow)
 		if err != nil {
-			_ = tran.Rollback()
-			return errors.Wrapf(err, "插入节点数据发生错误")
+			return errors.Wrapf(err, "插入流程数据发生错误")
 		}
-	}
 
-	// 写入数据到 FormGroup、FormFieldGroup、FieldOptionGroup、FieldPropertyGroup、FieldValidationGroup
-	if list := forms.All(); len(list) > 0 {
-		err = tran.Insert(list...)
-		if err != nil {
-			_ = tran.Rollback()
-			return errors.Wrapf(err, "插入表单数据发生错误")
+		// 写入数据到 NodeGroup、RouterGroup、AssignmentGroup、PropertyGroup
+		if list := nodes.All(); len(list) > 0 {
+			err = f.DB.InsertContext(ctx, list...)
+			if err != nil {
+				return errors.Wrapf(err, "插入节点数据发生错误")
+			}
 		}
-	}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程基础数据提交事物发生错误")
-	}
-	return nil
+		// 写入数据到 FormGroup、FormFieldGroup、FieldOptionGroup、FieldPropertyGroup、FieldValidationGroup
+		if list := forms.All(); len(list) > 0 {
+			err = f.DB.InsertContext(ctx, list...)
+			if err != nil {
+				return errors.Wrapf(err, "插入表单数据发生错误")
+			}
+		}
+		return nil
+	})
 }
 
 // QueryAllFlowPage 查询流程分页数据
-func (f *Flow) QueryAllFlowPage(params model.FlowQueryParam, pageIndex, pageSize uint) (
+func (f *Flow) QueryAllFlowPage(ctx context.Context, tenantID string, params model.FlowQueryParam, pageIndex, pageSize uint) (
 	int64,
 	[]*model.FlowQueryResult,
 	error,
 ) {
 	var (
-		where = "WHERE deleted=0 AND flag=1"
-		args  []interface{}
+		where = "WHERE deleted=0 AND flag=1 AND tenant_id=?"
+		args  = []interface{}{tenantID}
 	)
 
 	if code := params.Code; code != "" {
@@ -84,7 +79,7 @@ func (f *Flow) QueryAllFlowPage(params model.FlowQueryParam, pageIndex, pageSize
 		args = append(args, v)
 	}
 
-	n, err := f.DB.SelectInt(fmt.Sprintf("SELECT count(*) FROM %s %s", model.FlowTableName, where), args...)
+	n, err := f.DB.Executor(ctx).SelectInt(fmt.Sprintf("SELECT count(*) FROM %s %s", model.FlowTableName, where), args...)
 	if err != nil {
 		return 0, nil, errors.Wrapf(err, "查询分页数据发生错误")
 	} else if n == 0 {
@@ -97,7 +92,7 @@ func (f *Flow) QueryAllFlowPage(params model.FlowQueryParam, pageIndex, pageSize
 	}
 
 	var items []*model.FlowQueryResult
-	_, err = f.DB.Select(&items, query, args...)
+	_, err = f.DB.Executor(ctx).Select(&items, query, args...)
 	if err != nil {
 		return 0, nil, errors.Wrapf(err, "查询分页数据发生错误")
 	}
@@ -106,11 +101,11 @@ func (f *Flow) QueryAllFlowPage(params model.FlowQueryParam, pageIndex, pageSize
 }
 
 // GetFlow 获取流程数据
-func (f *Flow) GetFlow(recordID string) (*model.Flow, error) {
+func (f *Flow) GetFlow(ctx context.Context, recordID string) (*model.Flow, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND record_id=? LIMIT 1", model.FlowTableName)
 
 	var flow model.Flow
-	err := f.DB.SelectOne(&flow, query, recordID)
+	err := f.DB.Executor(ctx).SelectOne(&flow, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -121,12 +116,12 @@ func (f *Flow) GetFlow(recordID string) (*model.Flow, error) {
 }
 
 // GetFlowByCode 根据编号查询流程数据
-func (f *Flow) GetFlowByCode(code string) (*model.Flow, error) {
-	query := fmt.Sprintf("SELECT * FROM %s WHERE flag=1 AND status=1 AND code=? AND deleted=0 "+
+func (f *Flow) GetFlowByCode(ctx context.Context, tenantID, code string) (*model.Flow, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE flag=1 AND status=1 AND tenant_id=? AND code=? AND deleted=0 "+
 		"ORDER BY version DESC LIMIT 1", model.FlowTableName)
 
 	var flow model.Flow
-	err := f.DB.SelectOne(&flow, query, code)
+	err := f.DB.Executor(ctx).SelectOne(&flow, query, tenantID, code)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -138,14 +133,14 @@ func (f *Flow) GetFlowByCode(code string) (*model.Flow, error) {
 }
 
 // GetNodeByCode 根据节点编号获取流程节点
-func (f *Flow) GetNodeByCode(flowID, nodeCode string) (*model.Node, error) {
+func (f *Flow) GetNodeByCode(ctx context.Context, flowID, nodeCode string) (*model.Node, error) {
 	query := fmt.Sprintf(""+
 		"SELECT * FROM %s "+
 		"WHERE flow_id=? AND code=? AND deleted=0 "+
 		"ORDER BY order_num LIMIT 1", model.NodeTableName)
 
 	var node model.Node
-	err := f.DB.SelectOne(&node, query, flowID, nodeCode)
+	err := f.DB.Executor(ctx).SelectOne(&node, query, flowID, nodeCode)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -157,11 +152,11 @@ func (f *Flow) GetNodeByCode(flowID, nodeCode string) (*model.Node, error) {
 }
 
 // GetNode 获取流程节点
-func (f *Flow) GetNode(recordID string) (*model.Node, error) {
+func (f *Flow) GetNode(ctx context.Context, recordID string) (*model.Node, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE record_id=? AND deleted=0", model.NodeTableName)
 
 	var item model.Node
-	err := f.DB.SelectOne(&item, query, recordID)
+	err := f.DB.Executor(ctx).SelectOne(&item, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -173,13 +168,13 @@ func (f *Flow) GetNode(recordID string) (*model.Node, error) {
 }
 
 // CheckNodeCandidate 检查节点候选人
-func (f *Flow) CheckNodeCandidate(nodeInstanceID, userID string) (bool, error) {
+func (f *Flow) CheckNodeCandidate(ctx context.Context, nodeInstanceID, userID string) (bool, error) {
 	query := fmt.Sprintf("SELECT "+
 		"COUNT(*) "+
 		"FROM %s "+
 		"WHERE node_instance_id=? AND candidate_id=? AND deleted=0", model.NodeCandidateTableName)
 
-	n, err := f.DB.SelectInt(query, nodeInstanceID, userID)
+	n, err := f.DB.Executor(ctx).SelectInt(query, nodeInstanceID, userID)
 	if err != nil {
 		return false, errors.Wrapf(err, "检查节点候选人发生错误")
 	}
@@ -188,11 +183,11 @@ func (f *Flow) CheckNodeCandidate(nodeInstanceID, userID string) (bool, error) {
 }
 
 // QueryNodeCandidates 查询节点候选人
-func (f *Flow) QueryNodeCandidates(nodeInstanceID string) ([]*model.NodeCandidate, error) {
+func (f *Flow) QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]*model.NodeCandidate, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE node_instance_id=? AND deleted=0", model.NodeCandidateTableName)
 
 	var items []*model.NodeCandidate
-	_, err := f.DB.Select(&items, query, nodeInstanceID)
+	_, err := f.DB.Executor(ctx).Select(&items, query, nodeInstanceID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点候选人发生错误")
 	}
@@ -201,11 +196,11 @@ func (f *Flow) QueryNodeCandidates(nodeInstanceID string) ([]*model.NodeCandidat
 }
 
 // QueryNodeProperty 查询节点属性
-func (f *Flow) QueryNodeProperty(nodeID string) ([]*model.NodeProperty, error) {
+func (f *Flow) QueryNodeProperty(ctx context.Context, nodeID string) ([]*model.NodeProperty, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE node_id=? AND deleted=0", model.NodePropertyTableName)
 
 	var items []*model.NodeProperty
-	_, err := f.DB.Select(&items, query, nodeID)
+	_, err := f.DB.Executor(ctx).Select(&items, query, nodeID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点属性发生错误")
 	}
@@ -213,12 +208,79 @@ func (f *Flow) QueryNodeProperty(nodeID string) ([]*model.NodeProperty, error) {
 	return items, nil
 }
 
+// CreateInstanceHistory 创建实例历史(仅追加，不允许修改)
+func (f *Flow) CreateInstanceHistory(ctx context.Context, items ...*model.InstanceHistory) error {
+	for _, item := range items {
+		err := f.DB.InsertContext(ctx, item)
+		if err != nil {
+			return errors.Wrapf(err, "创建实例历史发生错误")
+		}
+	}
+	return nil
+}
+
+// QueryInstanceHistory 查询流程实例的历史，按操作顺序排列
+func (f *Flow) QueryInstanceHistory(ctx context.Context, flowInstanceID string) ([]*model.InstanceHistory, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flow_instance_id=? ORDER BY created,id", model.InstanceHistoryTableName)
+
+	var items []*model.InstanceHistory
+	_, err := f.DB.Executor(ctx).Select(&items, query, flowInstanceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询实例历史发生错误")
+	}
+	return items, nil
+}
+
+// CreateExpressionTrace 创建表达式执行记录
+func (f *Flow) CreateExpressionTrace(ctx context.Context, items ...*model.ExpressionTrace) error {
+	for _, item := range items {
+		err := f.DB.InsertContext(ctx, item)
+		if err != nil {
+			return errors.Wrapf(err, "创建表达式执行记录发生错误")
+		}
+	}
+	return nil
+}
+
+// QueryExpressionTrace 查询流程实例的表达式执行记录
+func (f *Flow) QueryExpressionTrace(ctx context.Context, flowInstanceID string) ([]*model.ExpressionTrace, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flow_instance_id=? ORDER BY id", model.ExpressionTraceTableName)
+
+	var items []*model.ExpressionTrace
+	_, err := f.DB.Executor(ctx).Select(&items, query, flowInstanceID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询表达式执行记录发生错误")
+	}
+	return items, nil
+}
+
+// QueryFlowProperty 查询流程属性
+func (f *Flow) QueryFlowProperty(ctx context.Context, flowID string) ([]*model.FlowProperty, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND flow_id=?", model.FlowPropertyTableName)
+
+	var items []*model.FlowProperty
+	_, err := f.DB.Executor(ctx).Select(&items, query, flowID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询流程属性发生错误")
+	}
+	return items, nil
+}
+
+// CreateDeadLetter 创建投递失败的通知
+func (f *Flow) CreateDeadLetter(ctx context.Context, item *model.DeadLetter) error {
+	err := f.DB.InsertContext(ctx, item)
+	if err != nil {
+		return errors.Wrapf(err, "创建投递失败的通知发生错误")
+	}
+	return nil
+}
+
 // QueryNodeRouters 查询节点路由
-func (f *Flow) QueryNodeRouters(sourceNodeID string) ([]*model.NodeRouter, error) {
+func (f *Flow) QueryNodeRouters(ctx context.Context, sourceNodeID string) ([]*model.NodeRouter, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE source_node_id=? AND deleted=0", model.NodeRouterTableName)
 
 	var items []*model.NodeRouter
-	_, err := f.DB.Select(&items, query, sourceNodeID)
+	_, err := f.DB.Executor(ctx).Select(&items, query, sourceNodeID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点路由发生错误")
 	}
@@ -227,11 +289,11 @@ func (f *Flow) QueryNodeRouters(sourceNodeID string) ([]*model.NodeRouter, error
 }
 
 // QueryNodeAssignments 查询节点指派
-func (f *Flow) QueryNodeAssignments(nodeID string) ([]*model.NodeAssignment, error) {
+func (f *Flow) QueryNodeAssignments(ctx context.Context, nodeID string) ([]*model.NodeAssignment, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE node_id=? AND deleted=0", model.NodeAssignmentTableName)
 
 	var items []*model.NodeAssignment
-	_, err := f.DB.Select(&items, query, nodeID)
+	_, err := f.DB.Executor(ctx).Select(&items, query, nodeID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询节点指派发生错误")
 	}
@@ -240,109 +302,277 @@ func (f *Flow) QueryNodeAssignments(nodeID string) ([]*model.NodeAssignment, err
 }
 
 // CreateFlowInstance 创建流程实例
-func (f *Flow) CreateFlowInstance(flowInstance *model.FlowInstance, nodeInstances ...*model.NodeInstance) error {
-	tran, err := f.DB.Begin()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程实例开启事物发生错误")
-	}
-
-	err = tran.Insert(flowInstance)
-	if err != nil {
-		err = tran.Rollback()
+func (f *Flow) CreateFlowInstance(ctx context.Context, flowInstance *model.FlowInstance, nodeInstances ...*model.NodeInstance) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.InsertContext(ctx, flowInstance)
 		if err != nil {
-			return errors.Wrapf(err, "创建流程实例回滚事物发生错误")
+			return errors.Wrapf(err, "插入流程实例数据发生错误")
 		}
-		return errors.Wrapf(err, "插入流程实例数据发生错误")
-	}
 
-	for _, n := range nodeInstances {
-		err = tran.Insert(n)
-		if err != nil {
-			err = tran.Rollback()
+		for _, n := range nodeInstances {
+			err = f.DB.InsertContext(ctx, n)
 			if err != nil {
-				return errors.Wrapf(err, "创建流程实例回滚事物发生错误")
+				return errors.Wrapf(err, "插入流程节点实例数据发生错误")
 			}
-			return errors.Wrapf(err, "插入流程节点实例数据发生错误")
 		}
-	}
-
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程实例提交事物发生错误")
-	}
-	return nil
+		return nil
+	})
 }
 
-// UpdateFlowInstance 更新流程实例信息
-func (f *Flow) UpdateFlowInstance(recordID string, info map[string]interface{}) error {
-	_, err := f.DB.UpdateByPK(model.FlowInstanceTableName, db.M{"record_id": recordID}, info)
+// UpdateFlowInstance 更新流程实例信息(仅在数据版本一致时生效)
+func (f *Flow) UpdateFlowInstance(ctx context.Context, recordID string, version int64, info map[string]interface{}) error {
+	err := f.DB.UpdateByVersionContext(ctx, model.FlowInstanceTableName, db.M{"record_id": recordID}, version, info)
 	if err != nil {
 		return errors.Wrapf(err, "更新流程实例信息发生错误")
 	}
 	return nil
 }
 
-// CheckFlowInstanceTodo 检查流程实例待办事项
-func (f *Flow) CheckFlowInstanceTodo(flowInstanceID string) (bool, error) {
+// ChangeFlowInstanceStatus 变更流程实例状态(仅在流程实例处于指定状态时生效)并记录实例历史
+func (f *Flow) ChangeFlowInstanceStatus(ctx context.Context, recordID string, fromStatus, toStatus int64, history *model.InstanceHistory) (bool, error) {
+	var ok bool
+	err := f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		exec := f.DB.Executor(ctx)
+		result, err := exec.Exec(fmt.Sprintf("UPDATE %s SET status=?,version=version+1,updated=? WHERE deleted=0 AND status=? AND record_id=?",
+			model.FlowInstanceTableName), toStatus, history.Created, fromStatus, recordID)
+		if err != nil {
+			return errors.Wrapf(err, "变更流程实例状态发生错误")
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+		ok = true
+
+		err = exec.Insert(history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return nil
+	})
+	return ok, err
+}
+
+// StopFlowInstance 停止流程实例，并关闭所有未完成的节点实例
+func (f *Flow) StopFlowInstance(ctx context.Context, recordID string, history *model.InstanceHistory) (bool, error) {
+	var ok bool
+	err := f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		exec := f.DB.Executor(ctx)
+		result, err := exec.Exec(fmt.Sprintf("UPDATE %s SET status=3,version=version+1,updated=? WHERE deleted=0 AND status IN(1,2) AND record_id=?",
+			model.FlowInstanceTableName), history.Created, recordID)
+		if err != nil {
+			return errors.Wrapf(err, "停止流程实例发生错误")
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil
+		}
+		ok = true
+
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET status=4,version=version+1,updated=? WHERE deleted=0 AND status IN(1,3) AND flow_instance_id=?",
+			model.NodeInstanceTableName), history.Created, recordID)
+		if err != nil {
+			return errors.Wrapf(err, "关闭节点实例发生错误")
+		}
+
+		err = exec.Insert(history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return nil
+	})
+	return ok, err
+}
+
+// CheckFlowInstanceTodo 检查流程实例待办事项(未完成的节点实例及待执行或执行失败的异步作业)
+// 使用锁定读取，在事务中读取最新提交的数据而不是事务开始时的快照
+func (f *Flow) CheckFlowInstanceTodo(ctx context.Context, flowInstanceID string) (bool, error) {
 	query := fmt.Sprintf("SELECT "+
 		"count(*) FROM %s "+
-		"WHERE status=1 AND flow_instance_id=? AND deleted=0", model.NodeInstanceTableName)
-	n, err := f.DB.SelectInt(query, flowInstanceID)
+		"WHERE status IN(1,3,5) AND flow_instance_id=? AND deleted=0 LOCK IN SHARE MODE", model.NodeInstanceTableName)
+	n, err := f.DB.Executor(ctx).SelectInt(query, flowInstanceID)
 	if err != nil {
 		return false, errors.Wrapf(err, "检查流程待办事项发生错误")
+	} else if n > 0 {
+		return true, nil
+	}
+
+	query = fmt.Sprintf("SELECT "+
+		"count(*) FROM %s "+
+		"WHERE status IN(1,3) AND flow_instance_id=? AND deleted=0 LOCK IN SHARE MODE", model.JobTableName)
+	n, err = f.DB.Executor(ctx).SelectInt(query, flowInstanceID)
+	if err != nil {
+		return false, errors.Wrapf(err, "检查流程待执行的异步作业发生错误")
 	}
 	return n > 0, nil
 }
 
 // CreateNodeInstance 创建流程节点实例
-func (f *Flow) CreateNodeInstance(nodeInstance *model.NodeInstance, nodeCandidates []*model.NodeCandidate) error {
-	tran, err := f.DB.Begin()
+func (f *Flow) CreateNodeInstance(ctx context.Context, nodeInstance *model.NodeInstance, nodeCandidates []*model.NodeCandidate) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.InsertContext(ctx, nodeInstance)
+		if err != nil {
+			return errors.Wrapf(err, "插入流程节点实例数据发生错误")
+		}
+
+		for _, c := range nodeCandidates {
+			err = f.DB.InsertContext(ctx, c)
+			if err != nil {
+				return errors.Wrapf(err, "插入流程节点候选人数据发生错误")
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateNodeInstance 更新节点实例信息(仅在数据版本一致时生效)
+func (f *Flow) UpdateNodeInstance(ctx context.Context, recordID string, version int64, info map[string]interface{}) error {
+	err := f.DB.UpdateByVersionContext(ctx, model.NodeInstanceTableName, db.M{"record_id": recordID}, version, info)
 	if err != nil {
-		return errors.Wrapf(err, "创建流程节点实例开启事物发生错误")
+		return errors.Wrapf(err, "更新节点实例信息发生错误")
 	}
+	return nil
+}
 
-	err = tran.Insert(nodeInstance)
-	if err != nil {
-		err = tran.Rollback()
+// ClaimNodeInstance 签收节点实例(仅在节点实例未被签收且数据版本一致时生效)
+func (f *Flow) ClaimNodeInstance(ctx context.Context, recordID string, version int64, userID string, history *model.InstanceHistory) (bool, error) {
+	var ok bool
+	err := f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.UpdateByVersionContext(ctx,
+			model.NodeInstanceTableName,
+			db.M{"record_id": recordID, "status": 1, "assignee": ""},
+			version,
+			db.M{"assignee": userID, "updated": history.Created})
 		if err != nil {
-			return errors.Wrapf(err, "创建流程节点实例回滚事物发生错误")
+			if db.IsConflict(err) {
+				return nil
+			}
+			return errors.Wrapf(err, "签收节点实例发生错误")
 		}
-		return errors.Wrapf(err, "插入流程节点实例数据发生错误")
-	}
+		ok = true
+
+		err = f.DB.InsertContext(ctx, history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return nil
+	})
+	return ok, err
+}
 
-	for _, c := range nodeCandidates {
-		err = tran.Insert(c)
+// UpdateNodeInstanceWithHistory 更新节点实例信息(仅在数据版本一致时生效)并记录实例历史
+func (f *Flow) UpdateNodeInstanceWithHistory(ctx context.Context, recordID string, version int64, info map[string]interface{}, history *model.InstanceHistory) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.UpdateByVersionContext(ctx, model.NodeInstanceTableName, db.M{"record_id": recordID}, version, info)
 		if err != nil {
-			err = tran.Rollback()
+			return errors.Wrapf(err, "更新节点实例信息发生错误")
+		}
+
+		err = f.DB.InsertContext(ctx, history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return nil
+	})
+}
+
+// TransferNodeInstance 转办节点实例(替换候选人并指定办理人，仅在数据版本一致时生效)
+func (f *Flow) TransferNodeInstance(ctx context.Context, recordID string, version int64, candidate *model.NodeCandidate, history *model.InstanceHistory) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		_, err := f.DB.Executor(ctx).Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND node_instance_id=?", model.NodeCandidateTableName), history.Created, recordID)
+		if err != nil {
+			return errors.Wrapf(err, "删除节点候选人发生错误")
+		}
+
+		err = f.DB.InsertContext(ctx, candidate)
+		if err != nil {
+			return errors.Wrapf(err, "插入流程节点候选人数据发生错误")
+		}
+
+		info := db.M{
+			"assignee": candidate.CandidateID,
+			"updated":  history.Created,
+		}
+		err = f.DB.UpdateByVersionContext(ctx, model.NodeInstanceTableName, db.M{"record_id": recordID}, version, info)
+		if err != nil {
+			return errors.Wrapf(err, "更新节点实例信息发生错误")
+		}
+
+		err = f.DB.InsertContext(ctx, history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return nil
+	})
+}
+
+// AddSignNodeInstance 加签节点实例(更新来源节点实例并创建加签节点实例，仅在来源节点实例数据版本一致时生效)
+func (f *Flow) AddSignNodeInstance(
+	ctx context.Context,
+	sourceID string,
+	sourceVersion int64,
+	info map[string]interface{},
+	nodeInstance *model.NodeInstance,
+	nodeCandidates []*model.NodeCandidate,
+	history *model.InstanceHistory,
+) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.UpdateByVersionContext(ctx, model.NodeInstanceTableName, db.M{"record_id": sourceID, "status": 1}, sourceVersion, info)
+		if err != nil {
+			return errors.Wrapf(err, "更新节点实例信息发生错误")
+		}
+
+		err = f.DB.InsertContext(ctx, nodeInstance)
+		if err != nil {
+			return errors.Wrapf(err, "插入加签节点实例数据发生错误")
+		}
+
+		for _, c := range nodeCandidates {
+			err = f.DB.InsertContext(ctx, c)
 			if err != nil {
-				return errors.Wrapf(err, "创建流程节点候选人回滚事物发生错误")
+				return errors.Wrapf(err, "插入加签节点候选人数据发生错误")
 			}
-			return errors.Wrapf(err, "插入流程节点候选人数据发生错误")
 		}
-	}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "创建流程节点实例提交事物发生错误")
-	}
-	return nil
+		err = f.DB.InsertContext(ctx, history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return nil
+	})
+}
+
+// DoneAddSignNodeInstance 完成前加签节点实例(仅在数据版本一致时生效)并恢复来源节点实例
+func (f *Flow) DoneAddSignNodeInstance(ctx context.Context, recordID string, version int64, info map[string]interface{}, parentID string) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.UpdateByVersionContext(ctx, model.NodeInstanceTableName, db.M{"record_id": recordID, "status": 1}, version, info)
+		if err != nil {
+			return errors.Wrapf(err, "更新加签节点实例信息发生错误")
+		}
+
+		_, err = f.DB.Executor(ctx).Exec(fmt.Sprintf("UPDATE %s SET status=1,version=version+1,updated=? WHERE deleted=0 AND status=3 AND record_id=?",
+			model.NodeInstanceTableName), info["updated"], parentID)
+		if err != nil {
+			return errors.Wrapf(err, "恢复加签来源节点实例发生错误")
+		}
+		return nil
+	})
 }
 
-// UpdateNodeInstance 更新节点实例信息
-func (f *Flow) UpdateNodeInstance(recordID string, info map[string]interface{}) error {
-	_, err := f.DB.UpdateByPK(model.NodeInstanceTableName, db.M{"record_id": recordID}, info)
+// LockFlowInstance 锁定流程实例(SELECT ... FOR UPDATE)，锁在事务结束时释放
+func (f *Flow) LockFlowInstance(ctx context.Context, recordID string) error {
+	query := fmt.Sprintf("SELECT id FROM %s WHERE record_id=? AND deleted=0 FOR UPDATE", model.FlowInstanceTableName)
+	_, err := f.DB.Executor(ctx).SelectInt(query, recordID)
 	if err != nil {
-		return errors.Wrapf(err, "更新节点实例信息发生错误")
+		return errors.Wrapf(err, "锁定流程实例发生错误")
 	}
 	return nil
 }
 
 // GetFlowInstance 获取流程实例
-func (f *Flow) GetFlowInstance(recordID string) (*model.FlowInstance, error) {
+func (f *Flow) GetFlowInstance(ctx context.Context, recordID string) (*model.FlowInstance, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE record_id=? AND deleted=0 LIMIT 1", model.FlowInstanceTableName)
 
 	var item model.FlowInstance
-	err := f.DB.SelectOne(&item, query, recordID)
+	err := f.DB.Executor(ctx).SelectOne(&item, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -354,11 +584,11 @@ func (f *Flow) GetFlowInstance(recordID string) (*model.FlowInstance, error) {
 }
 
 // GetNodeInstance 获取流程节点实例
-func (f *Flow) GetNodeInstance(recordID string) (*model.NodeInstance, error) {
+func (f *Flow) GetNodeInstance(ctx context.Context, recordID string) (*model.NodeInstance, error) {
 	query := fmt.Sprintf("SELECT * FROM %s WHERE record_id=? AND deleted=0 LIMIT 1", model.NodeInstanceTableName)
 
 	var item model.NodeInstance
-	err := f.DB.SelectOne(&item, query, recordID)
+	err := f.DB.Executor(ctx).SelectOne(&item, query, recordID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -370,35 +600,461 @@ func (f *Flow) GetNodeInstance(recordID string) (*model.NodeInstance, error) {
 }
 
 // CreateNodeTiming 创建定时节点
-func (f *Flow) CreateNodeTiming(item *model.NodeTiming) error {
-	err := f.DB.Insert(item)
+func (f *Flow) CreateNodeTiming(ctx context.Context, item *model.NodeTiming) error {
+	err := f.DB.InsertContext(ctx, item)
 	if err != nil {
 		return errors.Wrapf(err, "创建节点定时发生错误")
 	}
 	return nil
 }
 
+// GetIdempotency 获取幂等记录
+func (f *Flow) GetIdempotency(ctx context.Context, tenantID, key, operation string) (*model.Idempotency, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE tenant_id=? AND idempotency_key=? AND operation=? AND deleted=0 LIMIT 1", model.IdempotencyTableName)
+
+	var item model.Idempotency
+	err := f.DB.Executor(ctx).SelectOne(&item, query, tenantID, key, operation)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "获取幂等记录发生错误")
+	}
+
+	return &item, nil
+}
+
+// CreateIdempotency 创建幂等记录
+func (f *Flow) CreateIdempotency(ctx context.Context, item *model.Idempotency) error {
+	err := f.DB.InsertContext(ctx, item)
+	if err != nil {
+		return errors.Wrapf(err, "创建幂等记录发生错误")
+	}
+	return nil
+}
+
 // UpdateNodeTiming 更新定时节点
-func (f *Flow) UpdateNodeTiming(nodeInstanceID string, info map[string]interface{}) error {
-	_, err := f.DB.UpdateByPK(model.NodeTimingTableName, db.M{"node_instance_id": nodeInstanceID}, db.M(info))
+func (f *Flow) UpdateNodeTiming(ctx context.Context, nodeInstanceID string, info map[string]interface{}) error {
+	_, err := f.DB.UpdateByPKContext(ctx, model.NodeTimingTableName, db.M{"node_instance_id": nodeInstanceID}, db.M(info))
 	if err != nil {
 		return errors.Wrapf(err, "更新节点定时发生错误")
 	}
 	return nil
 }
 
+// SaveFlowVariables 保存流程实例变量(存在同名变量时更新变量值)
+func (f *Flow) SaveFlowVariables(ctx context.Context, items []*model.FlowVariable) error {
+	query := fmt.Sprintf("INSERT INTO %s(record_id,flow_instance_id,scope,name,type_code,value,created,updated,deleted) "+
+		"VALUES(?,?,?,?,?,?,?,?,0) "+
+		"ON DUPLICATE KEY UPDATE type_code=VALUES(type_code),value=VALUES(value),updated=VALUES(updated),deleted=0",
+		model.FlowVariableTableName)
+
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		for _, item := range items {
+			_, err := f.DB.Executor(ctx).Exec(query, item.RecordID, item.FlowInstanceID, item.Scope, item.Name,
+				item.TypeCode, item.Value, item.Created, item.Updated)
+			if err != nil {
+				return errors.Wrapf(err, "保存流程实例变量发生错误")
+			}
+		}
+		return nil
+	})
+}
+
+// QueryFlowVariables 查询流程实例变量
+// scopes 作用域列表(空字符串表示流程实例级别)
+func (f *Flow) QueryFlowVariables(ctx context.Context, flowInstanceID string, scopes ...string) ([]*model.FlowVariable, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE flow_instance_id=? AND scope IN(?) AND deleted=0 ORDER BY id",
+		model.FlowVariableTableName)
+
+	query, args, err := f.DB.In(query, flowInstanceID, scopes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询流程实例变量发生错误")
+	}
+
+	var items []*model.FlowVariable
+	_, err = f.DB.Executor(ctx).Select(&items, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询流程实例变量发生错误")
+	}
+	return items, nil
+}
+
+// QueryExpiredNodeTimings 查询已到期的节点定时(仅包含进行中的流程实例的待处理节点)
+func (f *Flow) QueryExpiredNodeTimings(ctx context.Context, expiredAt int64, limit int) ([]*model.NodeTiming, error) {
+	query := fmt.Sprintf(`SELECT
+			nt.*
+		FROM %s nt
+			JOIN %s ni ON nt.node_instance_id = ni.record_id AND ni.deleted = 0 AND ni.status = 1
+			JOIN %s fi ON ni.flow_instance_id = fi.record_id AND fi.deleted = 0 AND fi.status = 1
+		WHERE nt.deleted = 0 AND nt.expired_at <= ?
+		ORDER BY nt.expired_at LIMIT %d`,
+		model.NodeTimingTableName, model.NodeInstanceTableName, model.FlowInstanceTableName, limit)
+
+	var items []*model.NodeTiming
+	_, err := f.DB.Executor(ctx).Select(&items, query, expiredAt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询到期的节点定时发生错误")
+	}
+	return items, nil
+}
+
+// CountExpiredNodeTimings 查询已到期未处理的节点定时数量
+func (f *Flow) CountExpiredNodeTimings(ctx context.Context, expiredAt int64) (int64, error) {
+	query := fmt.Sprintf(`SELECT
+			COUNT(*)
+		FROM %s nt
+			JOIN %s ni ON nt.node_instance_id = ni.record_id AND ni.deleted = 0 AND ni.status = 1
+			JOIN %s fi ON ni.flow_instance_id = fi.record_id AND fi.deleted = 0 AND fi.status = 1
+		WHERE nt.deleted = 0 AND nt.expired_at <= ?`,
+		model.NodeTimingTableName, model.NodeInstanceTableName, model.FlowInstanceTableName)
+
+	n, err := f.DB.Executor(ctx).SelectInt(query, expiredAt)
+	if err != nil {
+		return 0, errors.Wrapf(err, "查询到期的节点定时数量发生错误")
+	}
+	return n, nil
+}
+
+// QueryNodeTodoCounts 查询进行中的流程实例各节点的待办数量
+func (f *Flow) QueryNodeTodoCounts(ctx context.Context) ([]*model.NodeTodoCount, error) {
+	query := fmt.Sprintf(`SELECT
+			fw.code 'flow_code',
+			n.code 'node_code',
+			COUNT(*) 'count'
+		FROM %s ni
+			JOIN %s fi ON ni.flow_instance_id = fi.record_id AND fi.deleted = 0 AND fi.status = 1
+			JOIN %s n ON ni.node_id = n.record_id
+			JOIN %s fw ON n.flow_id = fw.record_id
+		WHERE ni.deleted = 0 AND ni.status = 1
+		GROUP BY fw.code, n.code`,
+		model.NodeInstanceTableName, model.FlowInstanceTableName, model.NodeTableName, model.FlowTableName)
+
+	var items []*model.NodeTodoCount
+	_, err := f.DB.Executor(ctx).Select(&items, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询节点待办数量发生错误")
+	}
+	return items, nil
+}
+
+// QueryCandidateTodoCounts 查询候选人在租户下的待办数量(签收或转办给其他人的节点实例不计入)
+// 按委托规则转交的待办计入委托人
+func (f *Flow) QueryCandidateTodoCounts(ctx context.Context, tenantID string, candidateIDs []string) ([]*model.CandidateStat, error) {
+	query := fmt.Sprintf(`SELECT
+			COALESCE(NULLIF(nc.original_id, ''), nc.candidate_id) 'candidate_id',
+			COUNT(*) 'value'
+		FROM %s nc
+			JOIN %s ni ON nc.node_instance_id = ni.record_id AND ni.deleted = 0 AND ni.status = 1
+			JOIN %s fi ON ni.flow_instance_id = fi.record_id AND fi.deleted = 0 AND fi.status = 1
+		WHERE nc.deleted = 0 AND ni.tenant_id = ? AND (nc.candidate_id IN (?) OR nc.original_id IN (?)) AND (ni.assignee = '' OR ni.assignee = nc.candidate_id)
+		GROUP BY COALESCE(NULLIF(nc.original_id, ''), nc.candidate_id)`,
+		model.NodeCandidateTableName, model.NodeInstanceTableName, model.FlowInstanceTableName)
+
+	query, args, err := f.DB.In(query, tenantID, candidateIDs, candidateIDs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询候选人的待办数量发生错误")
+	}
+
+	var items []*model.CandidateStat
+	_, err = f.DB.Executor(ctx).Select(&items, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询候选人的待办数量发生错误")
+	}
+	return items, nil
+}
+
+// QueryCandidateLastAssigned 查询候选人在节点上最近一次被指派的候选记录ID
+// 按委托规则转交的指派计入委托人
+func (f *Flow) QueryCandidateLastAssigned(ctx context.Context, nodeID string, candidateIDs []string) ([]*model.CandidateStat, error) {
+	query := fmt.Sprintf(`SELECT
+			COALESCE(NULLIF(nc.original_id, ''), nc.candidate_id) 'candidate_id',
+			MAX(nc.id) 'value'
+		FROM %s nc
+			JOIN %s ni ON nc.node_instance_id = ni.record_id
+		WHERE ni.node_id = ? AND (nc.candidate_id IN (?) OR nc.original_id IN (?))
+		GROUP BY COALESCE(NULLIF(nc.original_id, ''), nc.candidate_id)`,
+		model.NodeCandidateTableName, model.NodeInstanceTableName)
+
+	query, args, err := f.DB.In(query, nodeID, candidateIDs, candidateIDs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询候选人最近的指派发生错误")
+	}
+
+	var items []*model.CandidateStat
+	_, err = f.DB.Executor(ctx).Select(&items, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询候选人最近的指派发生错误")
+	}
+	return items, nil
+}
+
+// CreateDelegationRule 创建委托规则
+func (f *Flow) CreateDelegationRule(ctx context.Context, item *model.DelegationRule) error {
+	err := f.DB.InsertContext(ctx, item)
+	if err != nil {
+		return errors.Wrapf(err, "创建委托规则发生错误")
+	}
+	return nil
+}
+
+// GetDelegationRule 获取委托规则
+func (f *Flow) GetDelegationRule(ctx context.Context, recordID string) (*model.DelegationRule, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE record_id=? AND deleted=0 LIMIT 1", model.DelegationRuleTableName)
+
+	var item model.DelegationRule
+	err := f.DB.Executor(ctx).SelectOne(&item, query, recordID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "获取委托规则发生错误")
+	}
+	return &item, nil
+}
+
+// DeleteDelegationRule 删除委托规则
+func (f *Flow) DeleteDelegationRule(ctx context.Context, recordID string) error {
+	query := fmt.Sprintf("UPDATE %s SET deleted=? WHERE record_id=? AND deleted=0", model.DelegationRuleTableName)
+	_, err := f.DB.Executor(ctx).Exec(query, time.Now().Unix(), recordID)
+	if err != nil {
+		return errors.Wrapf(err, "删除委托规则发生错误")
+	}
+	return nil
+}
+
+// QueryDelegationRules 查询委托人的委托规则，delegator为空时查询租户的所有委托规则
+func (f *Flow) QueryDelegationRules(ctx context.Context, tenantID, delegator string) ([]*model.DelegationRule, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND tenant_id=?", model.DelegationRuleTableName)
+	args := []interface{}{tenantID}
+	if delegator != "" {
+		query = fmt.Sprintf("%s AND delegator=?", query)
+		args = append(args, delegator)
+	}
+	query = fmt.Sprintf("%s ORDER BY start_time DESC, id DESC", query)
+
+	var items []*model.DelegationRule
+	_, err := f.DB.Executor(ctx).Select(&items, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询委托规则发生错误")
+	}
+	return items, nil
+}
+
+// QueryActiveDelegationRules 查询在指定时间生效并适用于流程的委托规则，指定流程的规则排在前面
+func (f *Flow) QueryActiveDelegationRules(ctx context.Context, tenantID, flowCode string, now int64) ([]*model.DelegationRule, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND tenant_id=? AND start_time<=? AND end_time>=? "+
+		"AND flow_code IN ('', ?) ORDER BY flow_code DESC, id DESC", model.DelegationRuleTableName)
+
+	var items []*model.DelegationRule
+	_, err := f.DB.Executor(ctx).Select(&items, query, tenantID, now, now, flowCode)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询生效的委托规则发生错误")
+	}
+	return items, nil
+}
+
+// CreateJob 创建异步作业
+func (f *Flow) CreateJob(ctx context.Context, item *model.Job) error {
+	err := f.DB.InsertContext(ctx, item)
+	if err != nil {
+		return errors.Wrapf(err, "创建异步作业发生错误")
+	}
+	return nil
+}
+
+// AcquireJobs 锁定并获取到期的异步作业(只获取进行中的流程实例的作业)
+// 未锁定或锁定已过期的作业由owner锁定至lockExpiredAt
+func (f *Flow) AcquireJobs(ctx context.Context, owner string, now, lockExpiredAt int64, limit int) ([]*model.Job, error) {
+	query := fmt.Sprintf(`UPDATE %s SET lock_owner=?,lock_expired_at=?,updated=?
+		WHERE deleted=0 AND status=1 AND due_at<=? AND (lock_owner='' OR lock_expired_at<?)
+			AND flow_instance_id IN(SELECT record_id FROM %s WHERE deleted=0 AND status=1)
+		ORDER BY due_at LIMIT %d`,
+		model.JobTableName, model.FlowInstanceTableName, limit)
+	_, err := f.DB.Executor(ctx).Exec(query, owner, lockExpiredAt, now, now, now)
+	if err != nil {
+		return nil, errors.Wrapf(err, "锁定异步作业发生错误")
+	}
+
+	query = fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 AND lock_owner=? AND lock_expired_at=? ORDER BY due_at",
+		model.JobTableName)
+	var items []*model.Job
+	_, err = f.DB.Executor(ctx).Select(&items, query, owner, lockExpiredAt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询锁定的异步作业发生错误")
+	}
+	return items, nil
+}
+
+// UpdateJob 更新异步作业信息(仅在作业由lockOwner锁定时生效)
+func (f *Flow) UpdateJob(ctx context.Context, recordID, lockOwner string, info map[string]interface{}) (bool, error) {
+	n, err := f.DB.UpdateByPKContext(ctx,
+		model.JobTableName,
+		db.M{"record_id": recordID, "lock_owner": lockOwner, "status": 1},
+		info)
+	if err != nil {
+		return false, errors.Wrapf(err, "更新异步作业信息发生错误")
+	}
+	return n > 0, nil
+}
+
+// RetryJob 重新执行失败的异步作业
+func (f *Flow) RetryJob(ctx context.Context, recordID string, retries, dueAt int64) (bool, error) {
+	n, err := f.DB.UpdateByPKContext(ctx,
+		model.JobTableName,
+		db.M{"record_id": recordID, "status": 3, "deleted": 0},
+		db.M{"status": 1, "retries": retries, "due_at": dueAt, "lock_owner": "", "lock_expired_at": 0, "updated": time.Now().Unix()})
+	if err != nil {
+		return false, errors.Wrapf(err, "重试异步作业发生错误")
+	}
+	return n > 0, nil
+}
+
+// DeleteJob 删除异步作业
+func (f *Flow) DeleteJob(ctx context.Context, recordID string) error {
+	_, err := f.DB.UpdateByPKContext(ctx, model.JobTableName, db.M{"record_id": recordID}, db.M{"deleted": time.Now().Unix()})
+	if err != nil {
+		return errors.Wrapf(err, "删除异步作业发生错误")
+	}
+	return nil
+}
+
+// CreateIncident 创建流程事件并标记流程实例存在未处理的事件
+func (f *Flow) CreateIncident(ctx context.Context, item *model.Incident) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		err := f.DB.InsertContext(ctx, item)
+		if err != nil {
+			return errors.Wrapf(err, "创建流程事件发生错误")
+		}
+		return f.RefreshFlowInstanceIncident(ctx, item.FlowInstanceID)
+	})
+}
+
+// GetIncident 获取流程事件
+func (f *Flow) GetIncident(ctx context.Context, recordID string) (*model.Incident, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE record_id=? AND deleted=0 LIMIT 1", model.IncidentTableName)
+
+	var item model.Incident
+	err := f.DB.Executor(ctx).SelectOne(&item, query, recordID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "获取流程事件发生错误")
+	}
+
+	return &item, nil
+}
+
+// QueryIncidents 查询租户未处理的流程事件，flowInstanceID为空时查询所有流程实例
+func (f *Flow) QueryIncidents(ctx context.Context, tenantID, flowInstanceID string) ([]*model.Incident, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 "+
+		"AND flow_instance_id IN (SELECT record_id FROM %s WHERE deleted=0 AND tenant_id=?)",
+		model.IncidentTableName, model.FlowInstanceTableName)
+	args := []interface{}{tenantID}
+	if flowInstanceID != "" {
+		query = fmt.Sprintf("%s AND flow_instance_id=?", query)
+		args = append(args, flowInstanceID)
+	}
+	query = fmt.Sprintf("%s ORDER BY id", query)
+
+	var items []*model.Incident
+	_, err := f.DB.Executor(ctx).Select(&items, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询流程事件发生错误")
+	}
+	return items, nil
+}
+
+// CloseIncident 关闭未处理的流程事件并记录实例历史
+func (f *Flow) CloseIncident(ctx context.Context, incident *model.Incident, status int64, history *model.InstanceHistory) (bool, error) {
+	var ok bool
+	err := f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		n, err := f.DB.UpdateByPKContext(ctx,
+			model.IncidentTableName,
+			db.M{"record_id": incident.RecordID, "status": 1},
+			db.M{"status": status, "operator": history.Operator, "updated": history.Created})
+		if err != nil {
+			return errors.Wrapf(err, "更新流程事件发生错误")
+		} else if n == 0 {
+			return nil
+		}
+		ok = true
+
+		err = f.DB.InsertContext(ctx, history)
+		if err != nil {
+			return errors.Wrapf(err, "插入实例历史数据发生错误")
+		}
+		return f.RefreshFlowInstanceIncident(ctx, incident.FlowInstanceID)
+	})
+	return ok, err
+}
+
+// RefreshFlowInstanceIncident 根据未处理的流程事件更新流程实例的事件标记
+func (f *Flow) RefreshFlowInstanceIncident(ctx context.Context, flowInstanceID string) error {
+	query := fmt.Sprintf("UPDATE %s SET incident=IF(EXISTS(SELECT 1 FROM %s WHERE deleted=0 AND status=1 AND flow_instance_id=?),1,0) WHERE record_id=?",
+		model.FlowInstanceTableName, model.IncidentTableName)
+	_, err := f.DB.Executor(ctx).Exec(query, flowInstanceID, flowInstanceID)
+	if err != nil {
+		return errors.Wrapf(err, "更新流程实例事件标记发生错误")
+	}
+	return nil
+}
+
+// CreateOutbox 创建发件箱事件
+func (f *Flow) CreateOutbox(ctx context.Context, item *model.Outbox) error {
+	err := f.DB.InsertContext(ctx, item)
+	if err != nil {
+		return errors.Wrapf(err, "创建发件箱事件发生错误")
+	}
+	return nil
+}
+
+// AcquireOutboxes 锁定并获取待投递的发件箱事件(按创建顺序)
+// 未锁定或锁定已过期的事件由owner锁定至lockExpiredAt
+func (f *Flow) AcquireOutboxes(ctx context.Context, owner string, now, lockExpiredAt int64, limit int) ([]*model.Outbox, error) {
+	query := fmt.Sprintf(`UPDATE %s SET lock_owner=?,lock_expired_at=?,updated=?
+		WHERE deleted=0 AND status=1 AND next_attempt_at<=? AND (lock_owner='' OR lock_expired_at<?)
+		ORDER BY id LIMIT %d`,
+		model.OutboxTableName, limit)
+	_, err := f.DB.Executor(ctx).Exec(query, owner, lockExpiredAt, now, now, now)
+	if err != nil {
+		return nil, errors.Wrapf(err, "锁定发件箱事件发生错误")
+	}
+
+	query = fmt.Sprintf("SELECT * FROM %s WHERE deleted=0 AND status=1 AND lock_owner=? AND lock_expired_at=? ORDER BY id",
+		model.OutboxTableName)
+	var items []*model.Outbox
+	_, err = f.DB.Executor(ctx).Select(&items, query, owner, lockExpiredAt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "查询锁定的发件箱事件发生错误")
+	}
+	return items, nil
+}
+
+// UpdateOutbox 更新发件箱事件(仅在事件由lockOwner锁定时生效)
+func (f *Flow) UpdateOutbox(ctx context.Context, recordID, lockOwner string, info map[string]interface{}) (bool, error) {
+	n, err := f.DB.UpdateByPKContext(ctx, model.OutboxTableName,
+		db.M{"record_id": recordID, "lock_owner": lockOwner, "status": 1},
+		info)
+	if err != nil {
+		return false, errors.Wrapf(err, "更新发件箱事件发生错误")
+	}
+	return n > 0, nil
+}
+
 // QueryDoneIDs 查询已办理的流程实例ID列表
-func (f *Flow) QueryDoneIDs(flowCode, userID string) ([]string, error) {
+func (f *Flow) QueryDoneIDs(ctx context.Context, tenantID, flowCode, userID string) ([]string, error) {
 	query := fmt.Sprintf("SELECT "+
 		"record_id "+
 		"FROM %s "+
-		"WHERE deleted=0 "+
+		"WHERE deleted=0 AND tenant_id=? "+
 		"AND flow_id IN (SELECT record_id FROM %s WHERE deleted=0 AND flag=1 AND code=?) "+
 		"AND record_id IN(SELECT flow_instance_id FROM %s WHERE deleted=0 AND status=2 AND processor=?)",
 		model.FlowInstanceTableName, model.FlowTableName, model.NodeInstanceTableName)
 
 	var items []*model.FlowInstance
-	_, err := f.DB.Select(&items, query, flowCode, userID)
+	_, err := f.DB.Executor(ctx).Select(&items, query, tenantID, flowCode, userID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询已办理的流程数据发生错误")
 	}
@@ -412,13 +1068,16 @@ func (f *Flow) QueryDoneIDs(flowCode, userID string) ([]string, error) {
 }
 
 // QueryTodo 查询用户的待办数据
-func (f *Flow) QueryTodo(typeCode string, flowCode string, userID string, limit int) ([]*model.FlowTodoResult, error) {
+func (f *Flow) QueryTodo(ctx context.Context, tenantID string, typeCode string, flowCode string, userID string, limit int) ([]*model.FlowTodoResult, error) {
 	var args []interface{}
 	query := fmt.Sprintf(`SELECT
 			ni.record_id,
 			ni.flow_instance_id,
 			ni.input_data,
 			ni.node_id,
+			ni.assignee,
+			ni.owner,
+			IFNULL((SELECT nc.original_id FROM %s nc WHERE nc.node_instance_id = ni.record_id AND nc.candidate_id = ? AND nc.deleted = 0 LIMIT 1), '') 'original_assignee',
 			f.data 'form_data',
 			f.type_code 'form_type',
 			fi.launcher,
@@ -432,12 +1091,16 @@ func (f *Flow) QueryTodo(typeCode string, flowCode string, userID string, limit
 			LEFT JOIN %s f ON n.form_id = f.record_id AND f.deleted = n.deleted
 			LEFT JOIN %s fw ON n.flow_id = fw.record_id AND fw.deleted=n.deleted
 		WHERE 
-			ni.deleted = 0 AND ni.status = 1 AND fi.status = 1 AND 
-			ni.record_id IN (SELECT node_instance_id FROM %s WHERE deleted = 0 AND candidate_id = ?)
-		`, model.NodeInstanceTableName, model.FlowInstanceTableName, model.NodeTableName,
+			ni.deleted = 0 AND ni.tenant_id = ? AND ni.status = 1 AND fi.status = 1 AND (
+				ni.assignee = ? OR (
+					ni.assignee = '' AND
+					ni.record_id IN (SELECT node_instance_id FROM %s WHERE deleted = 0 AND candidate_id = ?)
+				)
+			)
+		`, model.NodeCandidateTableName, model.NodeInstanceTableName, model.FlowInstanceTableName, model.NodeTableName,
 		model.FormTableName, model.FlowTableName, model.NodeCandidateTableName)
 
-	args = append(args, userID)
+	args = append(args, userID, tenantID, userID, userID)
 	if typeCode != "" {
 		query = fmt.Sprintf("%s AND fi.flow_id IN (SELECT record_id FROM %s WHERE deleted=0 AND flag=1 AND type_code=?)", query, model.FlowTableName)
 		args = append(args, typeCode)
@@ -448,7 +1111,7 @@ func (f *Flow) QueryTodo(typeCode string, flowCode string, userID string, limit
 	query = fmt.Sprintf("%s ORDER BY ni.id DESC LIMIT %d", query, limit)
 
 	var items []*model.FlowTodoResult
-	_, err := f.DB.Select(&items, query, args...)
+	_, err := f.DB.Executor(ctx).Select(&items, query, args...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "查询用户的待办数据发生错误")
 	}
@@ -456,52 +1119,45 @@ func (f *Flow) QueryTodo(typeCode string, flowCode string, userID string, limit
 }
 
 // DeleteFlow 删除流程
-func (f *Flow) DeleteFlow(flowID string) error {
-	tran, err := f.DB.Begin()
-	if err != nil {
-		return errors.Wrapf(err, "删除流程开启事物发生错误")
-	}
+func (f *Flow) DeleteFlow(ctx context.Context, flowID string) error {
+	return f.DB.ExecTrans(ctx, func(ctx context.Context) error {
+		exec := f.DB.Executor(ctx)
+		ctimeUnix := time.Now().Unix()
 
-	ctimeUnix := time.Now().Unix()
-	_, err = tran.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND record_id=?", model.FlowTableName), ctimeUnix, flowID)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "删除流程发生错误")
-	}
+		_, err := exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND record_id=?", model.FlowTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程发生错误")
+		}
 
-	_, err = tran.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND source_node_id IN(SELECT record_id FROM %s WHERE deleted=0 AND flow_id=?)", model.NodeRouterTableName, model.NodeTableName), ctimeUnix, flowID)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "删除流程节点路由发生错误")
-	}
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND source_node_id IN(SELECT record_id FROM %s WHERE deleted=0 AND flow_id=?)", model.NodeRouterTableName, model.NodeTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程节点路由发生错误")
+		}
 
-	_, err = tran.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND node_id IN(SELECT record_id FROM %s WHERE deleted=0 AND flow_id=?)", model.NodeAssignmentTableName, model.NodeTableName), ctimeUnix, flowID)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "删除流程节点指派发生错误")
-	}
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND node_id IN(SELECT record_id FROM %s WHERE deleted=0 AND flow_id=?)", model.NodeAssignmentTableName, model.NodeTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程节点指派发生错误")
+		}
 
-	_, err = tran.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND node_id IN(SELECT record_id FROM %s WHERE deleted=0 AND flow_id=?)", model.NodePropertyTableName, model.NodeTableName), ctimeUnix, flowID)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "删除流程节点属性发生错误")
-	}
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND node_id IN(SELECT record_id FROM %s WHERE deleted=0 AND flow_id=?)", model.NodePropertyTableName, model.NodeTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程节点属性发生错误")
+		}
 
-	_, err = tran.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND flow_id=?", model.NodeTableName), ctimeUnix, flowID)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "删除流程节点发生错误")
-	}
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND flow_id=?", model.NodeTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程节点发生错误")
+		}
 
-	_, err = tran.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND flow_id=?", model.FormTableName), ctimeUnix, flowID)
-	if err != nil {
-		_ = tran.Rollback()
-		return errors.Wrapf(err, "删除流程表单发生错误")
-	}
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND flow_id=?", model.FormTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程表单发生错误")
+		}
 
-	err = tran.Commit()
-	if err != nil {
-		return errors.Wrapf(err, "删除流程提交事物发生错误")
-	}
-	return nil
+		_, err = exec.Exec(fmt.Sprintf("UPDATE %s SET deleted=? WHERE deleted=0 AND flow_id=?", model.FlowPropertyTableName), ctimeUnix, flowID)
+		if err != nil {
+			return errors.Wrapf(err, "删除流程属性发生错误")
+		}
+		return nil
+	})
 }
@@ -1,49 +1,67 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/metadata"
+	"github.com/chapin666/kitten/pkg/types"
 	"github.com/chapin666/kitten/pkg/util"
 	"github.com/chapin666/kitten/repository"
-	"sync"
+	"github.com/pkg/errors"
 	"time"
 )
 
 // Flow 流程管理
 type Flow struct {
-	sync.RWMutex
 	FlowModel *repository.Flow `inject:""`
 }
 
+// ExecTrans 在事务中执行函数，函数返回错误时回滚所有数据变更
+func (f *Flow) ExecTrans(ctx context.Context, fn func(context.Context) error) error {
+	return f.FlowModel.ExecTrans(ctx, fn)
+}
+
 // CreateFlow 创建流程数据
-func (f *Flow) CreateFlow(flow *model.Flow, nodes *model.NodeOperating, forms *model.FormOperating) error {
+func (f *Flow) CreateFlow(ctx context.Context, flow *model.Flow, nodes *model.NodeOperating, forms *model.FormOperating) error {
 	if flow.Flag == 0 {
 		flow.Flag = 1
 	}
-	return f.FlowModel.CreateFlow(flow, nodes, forms)
+	flow.TenantID = tenantOf(ctx)
+	return f.FlowModel.CreateFlow(ctx, flow, nodes, forms)
+}
+
+// 获取上下文中的租户
+func tenantOf(ctx context.Context) string {
+	return metadata.FromContext(ctx).TenantID
 }
 
 
 // QueryAllFlowPage 查询流程分页数据
-func (f *Flow) QueryAllFlowPage(params model.FlowQueryParam, pageIndex, pageSize uint) (int64, []*model.FlowQueryResult, error) {
-	return f.FlowModel.QueryAllFlowPage(params, pageIndex, pageSize)
+func (f *Flow) QueryAllFlowPage(ctx context.Context, params model.FlowQueryParam, pageIndex, pageSize uint) (int64, []*model.FlowQueryResult, error) {
+	return f.FlowModel.QueryAllFlowPage(ctx, tenantOf(ctx), params, pageIndex, pageSize)
 }
 
-// GetFlow 获取流程数据
-func (f *Flow) GetFlow(recordID string) (*model.Flow, error) {
-	return f.FlowModel.GetFlow(recordID)
+// GetFlow 获取流程数据，其他租户的流程返回nil
+func (f *Flow) GetFlow(ctx context.Context, recordID string) (*model.Flow, error) {
+	flow, err := f.FlowModel.GetFlow(ctx, recordID)
+	if err != nil || flow == nil || flow.TenantID != tenantOf(ctx) {
+		return nil, err
+	}
+	return flow, nil
 }
 
 // GetFlowByCode 根据编号查询流程数据
-func (f *Flow) GetFlowByCode(code string) (*model.Flow, error) {
-	return f.FlowModel.GetFlowByCode(code)
+func (f *Flow) GetFlowByCode(ctx context.Context, code string) (*model.Flow, error) {
+	return f.FlowModel.GetFlowByCode(ctx, tenantOf(ctx), code)
 }
 
 // LaunchFlowInstance 发起流程实例
-func (f *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData []byte) (*model.NodeInstance, error) {
+func (f *Flow) LaunchFlowInstance(ctx context.Context, flowCode, nodeCode, launcher string, inputData []byte) (*model.NodeInstance, error) {
 
 	// 根据工作流id查询数据库
-	flow, err := f.FlowModel.GetFlowByCode(flowCode)
+	flow, err := f.FlowModel.GetFlowByCode(ctx, tenantOf(ctx), flowCode)
 	if err != nil {
 		return nil, err
 	}
@@ -52,7 +70,7 @@ func (f *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData
 	}
 
 	// 根据nodeCode获取node
-	node, err := f.FlowModel.GetNodeByCode(flow.RecordID, nodeCode)
+	node, err := f.FlowModel.GetNodeByCode(ctx, flow.RecordID, nodeCode)
 	if err != nil {
 		return nil, err
 	}
@@ -63,23 +81,34 @@ func (f *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData
 	// 创建flow实例
 	flowInstance := &model.FlowInstance{
 		RecordID:   util.UUID(),
+		TenantID:   flow.TenantID,
 		FlowID:     flow.RecordID,
 		Launcher:   launcher,
 		LaunchTime: time.Now().Unix(),
 		Status:     1,
+		Metadata:   metadata.Encode(ctx),
 		Created:    time.Now().Unix(),
 	}
 	// 创建node实例
 	nodeInstance := &model.NodeInstance{
 		RecordID:       util.UUID(),
+		TenantID:       flow.TenantID,
 		FlowInstanceID: flowInstance.RecordID,
 		NodeID:         node.RecordID,
 		InputData:      string(inputData),
 		Status:         1,
+		Metadata:       metadata.Encode(ctx),
 		Created:        flowInstance.Created,
 	}
 
-	err = f.FlowModel.CreateFlowInstance(flowInstance, nodeInstance)
+	err = f.FlowModel.CreateFlowInstance(ctx, flowInstance, nodeInstance)
+	if err != nil {
+		return nil, err
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionStart, launcher, "")
+	history.Data = string(inputData)
+	err = f.FlowModel.CreateInstanceHistory(ctx, history)
 	if err != nil {
 		return nil, err
 	}
@@ -89,40 +118,324 @@ func (f *Flow) LaunchFlowInstance(flowCode, nodeCode, launcher string, inputData
 
 
 // GetNode 获取流程节点
-func (f *Flow) GetNode(recordID string) (*model.Node, error) {
-	return f.FlowModel.GetNode(recordID)
+func (f *Flow) GetNode(ctx context.Context, recordID string) (*model.Node, error) {
+	return f.FlowModel.GetNode(ctx, recordID)
 }
 
-// GetFlowInstance 获取流程实例
-func (f *Flow) GetFlowInstance(recordID string) (*model.FlowInstance, error) {
-	return f.FlowModel.GetFlowInstance(recordID)
+// GetFlowInstance 获取流程实例，其他租户的流程实例返回nil
+func (f *Flow) GetFlowInstance(ctx context.Context, recordID string) (*model.FlowInstance, error) {
+	item, err := f.FlowModel.GetFlowInstance(ctx, recordID)
+	if err != nil || item == nil || item.TenantID != tenantOf(ctx) {
+		return nil, err
+	}
+	return item, nil
 }
 
-// GetNodeInstance 获取流程节点实例
-func (f *Flow) GetNodeInstance(recordID string) (*model.NodeInstance, error) {
-	return f.FlowModel.GetNodeInstance(recordID)
+// GetNodeInstance 获取流程节点实例，其他租户的节点实例返回nil
+func (f *Flow) GetNodeInstance(ctx context.Context, recordID string) (*model.NodeInstance, error) {
+	item, err := f.FlowModel.GetNodeInstance(ctx, recordID)
+	if err != nil || item == nil || item.TenantID != tenantOf(ctx) {
+		return nil, err
+	}
+	return item, nil
 }
 
 
 // QueryNodeCandidates 查询节点候选人
-func (f *Flow) QueryNodeCandidates(nodeInstanceID string) ([]*model.NodeCandidate, error) {
-	return f.FlowModel.QueryNodeCandidates(nodeInstanceID)
+func (f *Flow) QueryNodeCandidates(ctx context.Context, nodeInstanceID string) ([]*model.NodeCandidate, error) {
+	return f.FlowModel.QueryNodeCandidates(ctx, nodeInstanceID)
 }
 
 
 // CheckNodeCandidate 检查节点候选人
-func (f *Flow) CheckNodeCandidate(nodeInstanceID, userID string) (bool, error) {
-	return f.FlowModel.CheckNodeCandidate(nodeInstanceID, userID)
+func (f *Flow) CheckNodeCandidate(ctx context.Context, nodeInstanceID, userID string) (bool, error) {
+	return f.FlowModel.CheckNodeCandidate(ctx, nodeInstanceID, userID)
 }
 
 
-// DoneNodeInstance 完成节点实例
-func (f *Flow) DoneNodeInstance(nodeInstanceID, processor string, outData []byte) error {
-	// 加锁保证节点实例的处理过程
-	f.Lock()
-	defer f.Unlock()
+// CheckNodeHandler 检查节点实例的当前处理人
+// 节点实例已指定办理人时只有办理人可以处理，否则由候选人处理
+func (f *Flow) CheckNodeHandler(ctx context.Context, nodeInstance *model.NodeInstance, userID string) (bool, error) {
+	if nodeInstance.Assignee != "" {
+		return nodeInstance.Assignee == userID, nil
+	}
+	return f.FlowModel.CheckNodeCandidate(ctx, nodeInstance.RecordID, userID)
+}
+
+// 获取待处理的节点实例并检查处理人
+func (f *Flow) getHandleNodeInstance(ctx context.Context, nodeInstanceID, userID string) (*model.NodeInstance, error) {
+	nodeInstance, err := f.GetNodeInstance(ctx, nodeInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if nodeInstance == nil || nodeInstance.Status != 1 {
+		return nil, fmt.Errorf("无效的处理节点")
+	}
+
+	exists, err := f.CheckNodeHandler(ctx, nodeInstance, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("无效的节点处理人")
+	}
+
+	flowInstance, err := f.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if flowInstance == nil || flowInstance.Status != 1 {
+		return nil, fmt.Errorf("流程实例未在进行中")
+	}
+	return nodeInstance, nil
+}
+
+func newInstanceHistory(ctx context.Context, nodeInstance *model.NodeInstance, action, operator, target string) *model.InstanceHistory {
+	return &model.InstanceHistory{
+		RecordID:       util.UUID(),
+		FlowInstanceID: nodeInstance.FlowInstanceID,
+		NodeInstanceID: nodeInstance.RecordID,
+		Action:         action,
+		Operator:       operator,
+		Target:         target,
+		Metadata:       metadata.Encode(ctx),
+		Created:        time.Now().Unix(),
+	}
+}
+
+func newFlowInstanceHistory(ctx context.Context, flowInstanceID, action string) *model.InstanceHistory {
+	return &model.InstanceHistory{
+		RecordID:       util.UUID(),
+		FlowInstanceID: flowInstanceID,
+		Action:         action,
+		Metadata:       metadata.Encode(ctx),
+		Created:        time.Now().Unix(),
+	}
+}
+
+// ClaimNodeInstance 签收节点实例，签收后仅签收人可以处理
+func (f *Flow) ClaimNodeInstance(ctx context.Context, nodeInstanceID, userID string) error {
+	nodeInstance, err := f.getHandleNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return err
+	}
+	if nodeInstance.Assignee != "" {
+		return errors.New("节点实例已被签收")
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionClaim, userID, userID)
+	ok, err := f.FlowModel.ClaimNodeInstance(ctx, nodeInstanceID, nodeInstance.Version, userID, history)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.New("节点实例已被签收")
+	}
+	return nil
+}
+
+// UnclaimNodeInstance 取消签收节点实例，取消后节点实例重新由候选人处理
+func (f *Flow) UnclaimNodeInstance(ctx context.Context, nodeInstanceID, userID string) error {
+	nodeInstance, err := f.getHandleNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return err
+	}
+	if nodeInstance.Assignee == "" {
+		return errors.New("节点实例未被签收")
+	}
+	if nodeInstance.DelegateStatus == 1 {
+		return errors.New("节点实例正在委派中")
+	}
+
+	info := map[string]interface{}{
+		"assignee": "",
+		"updated":  time.Now().Unix(),
+	}
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionUnclaim, userID, "")
+	return f.FlowModel.UpdateNodeInstanceWithHistory(ctx, nodeInstanceID, nodeInstance.Version, info, history)
+}
+
+// TransferNodeInstance 转办节点实例，转办后接收人成为唯一的候选人及办理人
+func (f *Flow) TransferNodeInstance(ctx context.Context, nodeInstanceID, userID, targetID string) error {
+	nodeInstance, err := f.getHandleNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return err
+	}
+	if nodeInstance.DelegateStatus == 1 {
+		return errors.New("节点实例正在委派中")
+	}
+	if targetID == "" || targetID == userID {
+		return errors.New("无效的转办接收人")
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionTransfer, userID, targetID)
+	candidate := &model.NodeCandidate{
+		RecordID:       util.UUID(),
+		NodeInstanceID: nodeInstanceID,
+		CandidateID:    targetID,
+		Created:        history.Created,
+	}
+	return f.FlowModel.TransferNodeInstance(ctx, nodeInstanceID, nodeInstance.Version, candidate, history)
+}
+
+// DelegateNodeInstance 委派节点实例，被委派人解决后节点实例归还委派人处理
+func (f *Flow) DelegateNodeInstance(ctx context.Context, nodeInstanceID, userID, targetID string) error {
+	nodeInstance, err := f.getHandleNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return err
+	}
+	if nodeInstance.DelegateStatus == 1 {
+		return errors.New("节点实例正在委派中")
+	}
+	if targetID == "" || targetID == userID {
+		return errors.New("无效的被委派人")
+	}
+
+	info := map[string]interface{}{
+		"assignee":        targetID,
+		"owner":           userID,
+		"delegate_status": 1,
+		"updated":         time.Now().Unix(),
+	}
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionDelegate, userID, targetID)
+	return f.FlowModel.UpdateNodeInstanceWithHistory(ctx, nodeInstanceID, nodeInstance.Version, info, history)
+}
+
+// ResolveNodeInstance 解决委派的节点实例，节点实例归还委派人处理
+func (f *Flow) ResolveNodeInstance(ctx context.Context, nodeInstanceID, userID string, inputData []byte) error {
+	nodeInstance, err := f.getHandleNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return err
+	}
+	if nodeInstance.DelegateStatus != 1 {
+		return errors.New("节点实例未被委派")
+	}
+
+	info := map[string]interface{}{
+		"assignee":        nodeInstance.Owner,
+		"delegate_status": 2,
+		"updated":         time.Now().Unix(),
+	}
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionResolve, userID, nodeInstance.Owner)
+	history.Data = string(inputData)
+	return f.FlowModel.UpdateNodeInstanceWithHistory(ctx, nodeInstanceID, nodeInstance.Version, info, history)
+}
+
+// AddSignNodeInstance 加签节点实例
+// signType 加签类型(model.AddSignTypeBefore:前加签 model.AddSignTypeAfter:后加签)
+// 前加签：来源节点实例进入等待加签状态，加签人处理完成后恢复由原处理人处理
+// 后加签：来源节点实例由当前处理人完成，加签人处理完成后继续流向原节点的下一节点
+func (f *Flow) AddSignNodeInstance(
+	ctx context.Context,
+	nodeInstanceID,
+	userID string,
+	signType int64,
+	signUserIDs []string,
+	outData []byte,
+) (*model.NodeInstance, error) {
+	if signType != model.AddSignTypeBefore && signType != model.AddSignTypeAfter {
+		return nil, errors.New("无效的加签类型")
+	}
+	if len(signUserIDs) == 0 {
+		return nil, errors.New("加签人不能为空")
+	}
+
+	source, err := f.getHandleNodeInstance(ctx, nodeInstanceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if source.DelegateStatus == 1 {
+		return nil, errors.New("节点实例正在委派中")
+	}
+	if signType == model.AddSignTypeAfter && source.AddSignType == model.AddSignTypeBefore {
+		return nil, errors.New("前加签节点实例不支持后加签")
+	}
+
+	node, err := f.FlowModel.GetNode(ctx, source.NodeID)
+	if err != nil {
+		return nil, err
+	} else if node == nil || node.TypeCode != types.UserTask.String() {
+		return nil, errors.New("只有人工任务节点支持加签")
+	}
+
+	now := time.Now().Unix()
+	nodeInstance := &model.NodeInstance{
+		RecordID:       util.UUID(),
+		TenantID:       source.TenantID,
+		FlowInstanceID: source.FlowInstanceID,
+		NodeID:         source.NodeID,
+		InputData:      source.InputData,
+		ParentID:       source.RecordID,
+		AddSignType:    signType,
+		Status:         1,
+		Metadata:       metadata.Encode(ctx),
+		Created:        now,
+	}
+
+	var nodeCandidates []*model.NodeCandidate
+	for _, c := range signUserIDs {
+		nodeCandidates = append(nodeCandidates, &model.NodeCandidate{
+			RecordID:       util.UUID(),
+			NodeInstanceID: nodeInstance.RecordID,
+			CandidateID:    c,
+			Created:        now,
+		})
+	}
+
+	var info map[string]interface{}
+	action := model.HistoryActionAddSignBefore
+	if signType == model.AddSignTypeBefore {
+		info = map[string]interface{}{
+			"status":  3,
+			"updated": now,
+		}
+	} else {
+		action = model.HistoryActionAddSignAfter
+		info = map[string]interface{}{
+			"processor":    userID,
+			"process_time": now,
+			"out_data":     string(outData),
+			"status":       2,
+			"updated":      now,
+		}
+	}
+
+	history := newInstanceHistory(ctx, source, action, userID, "")
+	data, _ := json.Marshal(signUserIDs)
+	history.Data = string(data)
+
+	err = f.FlowModel.AddSignNodeInstance(ctx, source.RecordID, source.Version, info, nodeInstance, nodeCandidates, history)
+	if err != nil {
+		return nil, err
+	}
+	return nodeInstance, nil
+}
+
+// DoneAddSignNodeInstance 完成前加签节点实例，并恢复来源节点实例的处理
+func (f *Flow) DoneAddSignNodeInstance(ctx context.Context, nodeInstance *model.NodeInstance, processor string, outData []byte) error {
+	if nodeInstance.AddSignType != model.AddSignTypeBefore || nodeInstance.ParentID == "" {
+		return errors.New("无效的前加签节点实例")
+	}
 
-	nodeInstance, err := f.FlowModel.GetNodeInstance(nodeInstanceID)
+	info := map[string]interface{}{
+		"processor":    processor,
+		"process_time": time.Now().Unix(),
+		"out_data":     string(outData),
+		"status":       2,
+		"updated":      time.Now().Unix(),
+	}
+	err := f.FlowModel.DoneAddSignNodeInstance(ctx, nodeInstance.RecordID, nodeInstance.Version, info, nodeInstance.ParentID)
+	if err != nil {
+		return err
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionComplete, processor, "")
+	history.Data = string(outData)
+	return f.FlowModel.CreateInstanceHistory(ctx, history)
+}
+
+// DoneNodeInstance 完成节点实例
+func (f *Flow) DoneNodeInstance(ctx context.Context, nodeInstanceID, processor string, outData []byte) error {
+	nodeInstance, err := f.GetNodeInstance(ctx, nodeInstanceID)
 	if err != nil {
 		return err
 	}
@@ -138,66 +451,204 @@ func (f *Flow) DoneNodeInstance(nodeInstanceID, processor string, outData []byte
 		"status":       2,
 		"updated":      time.Now().Unix(),
 	}
-	return f.FlowModel.UpdateNodeInstance(nodeInstanceID, info)
+	err = f.FlowModel.UpdateNodeInstance(ctx, nodeInstanceID, nodeInstance.Version, info)
+	if err != nil {
+		return err
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionComplete, processor, "")
+	history.Data = string(outData)
+	return f.FlowModel.CreateInstanceHistory(ctx, history)
 }
 
 
+// UpdateNodeInstanceStatus 更新节点实例状态(仅在数据版本一致时生效)，并同步更新nodeInstance
+func (f *Flow) UpdateNodeInstanceStatus(ctx context.Context, nodeInstance *model.NodeInstance, status int64) error {
+	now := time.Now().Unix()
+	err := f.FlowModel.UpdateNodeInstance(ctx, nodeInstance.RecordID, nodeInstance.Version, map[string]interface{}{
+		"status":  status,
+		"updated": now,
+	})
+	if err != nil {
+		return err
+	}
+
+	nodeInstance.Status = status
+	nodeInstance.Version++
+	nodeInstance.Updated = now
+	return nil
+}
+
+// LockFlowInstance 在事务中锁定流程实例，同一流程实例的流转依次执行
+func (f *Flow) LockFlowInstance(ctx context.Context, flowInstanceID string) error {
+	return f.FlowModel.LockFlowInstance(ctx, flowInstanceID)
+}
+
 // CheckFlowInstanceTodo 检查流程实例待办事项
-func (f *Flow) CheckFlowInstanceTodo(flowInstanceID string) (bool, error) {
-	return f.FlowModel.CheckFlowInstanceTodo(flowInstanceID)
+func (f *Flow) CheckFlowInstanceTodo(ctx context.Context, flowInstanceID string) (bool, error) {
+	return f.FlowModel.CheckFlowInstanceTodo(ctx, flowInstanceID)
 }
 
 
 // DoneFlowInstance 完成流程实例
-func (f *Flow) DoneFlowInstance(flowInstanceID string) error {
+func (f *Flow) DoneFlowInstance(ctx context.Context, flowInstanceID, processor string) error {
+	flowInstance, err := f.GetFlowInstance(ctx, flowInstanceID)
+	if err != nil {
+		return err
+	} else if flowInstance == nil || flowInstance.Status == 9 {
+		return fmt.Errorf("无效的流程实例")
+	}
+
 	info := map[string]interface{}{
-		"status": 9,
+		"status":  9,
+		"updated": time.Now().Unix(),
 	}
-	return f.FlowModel.UpdateFlowInstance(flowInstanceID, info)
+	err = f.FlowModel.UpdateFlowInstance(ctx, flowInstanceID, flowInstance.Version, info)
+	if err != nil {
+		return err
+	}
+
+	history := newFlowInstanceHistory(ctx, flowInstanceID, model.HistoryActionEnd)
+	history.Operator = processor
+	return f.FlowModel.CreateInstanceHistory(ctx, history)
+}
+
+// AddRouteHistory 记录节点实例的路由决策
+func (f *Flow) AddRouteHistory(ctx context.Context, nodeInstance *model.NodeInstance, processor string, decisions []*model.RouteDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(decisions)
+	if err != nil {
+		return err
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionRoute, processor, "")
+	history.Data = string(data)
+	return f.FlowModel.CreateInstanceHistory(ctx, history)
+}
+
+// ViewNodeInstance 查看节点实例并记录查看历史
+func (f *Flow) ViewNodeInstance(ctx context.Context, nodeInstanceID, userID string) (*model.NodeInstance, error) {
+	nodeInstance, err := f.GetNodeInstance(ctx, nodeInstanceID)
+	if err != nil {
+		return nil, err
+	} else if nodeInstance == nil {
+		return nil, nil
+	}
+
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionView, userID, "")
+	err = f.FlowModel.CreateInstanceHistory(ctx, history)
+	if err != nil {
+		return nil, err
+	}
+	return nodeInstance, nil
+}
+
+// AddTimerHistory 记录节点定时触发
+func (f *Flow) AddTimerHistory(ctx context.Context, nodeInstance *model.NodeInstance, processor string) error {
+	history := newInstanceHistory(ctx, nodeInstance, model.HistoryActionTimer, processor, "")
+	return f.FlowModel.CreateInstanceHistory(ctx, history)
+}
+
+// CreateExpressionTrace 保存表达式执行记录
+func (f *Flow) CreateExpressionTrace(ctx context.Context, trace *model.ExpressionTrace) error {
+	item := *trace
+	item.ID = 0
+	return f.FlowModel.CreateExpressionTrace(ctx, &item)
+}
+
+// QueryExpressionTrace 查询流程实例的表达式执行记录
+func (f *Flow) QueryExpressionTrace(ctx context.Context, flowInstanceID string) ([]*model.ExpressionTrace, error) {
+	return f.FlowModel.QueryExpressionTrace(ctx, flowInstanceID)
+}
+
+// QueryInstanceHistory 查询流程实例的历史
+func (f *Flow) QueryInstanceHistory(ctx context.Context, flowInstanceID string) ([]*model.InstanceHistory, error) {
+	return f.FlowModel.QueryInstanceHistory(ctx, flowInstanceID)
 }
 
 // QueryNodeRouters 查询节点路由
-func (f *Flow) QueryNodeRouters(sourceNodeID string) ([]*model.NodeRouter, error) {
-	return f.FlowModel.QueryNodeRouters(sourceNodeID)
+func (f *Flow) QueryNodeRouters(ctx context.Context, sourceNodeID string) ([]*model.NodeRouter, error) {
+	return f.FlowModel.QueryNodeRouters(ctx, sourceNodeID)
+}
+
+// QueryCandidateTodoCounts 查询候选人的待办数量
+func (f *Flow) QueryCandidateTodoCounts(ctx context.Context, candidateIDs []string) (map[string]int64, error) {
+	items, err := f.FlowModel.QueryCandidateTodoCounts(ctx, tenantOf(ctx), candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	return candidateStats(items), nil
+}
+
+// QueryCandidateLastAssigned 查询候选人在节点上最近一次被指派的顺序(值越大越近，未指派过的候选人不包含在结果中)
+func (f *Flow) QueryCandidateLastAssigned(ctx context.Context, nodeID string, candidateIDs []string) (map[string]int64, error) {
+	items, err := f.FlowModel.QueryCandidateLastAssigned(ctx, nodeID, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	return candidateStats(items), nil
+}
+
+func candidateStats(items []*model.CandidateStat) map[string]int64 {
+	m := make(map[string]int64, len(items))
+	for _, item := range items {
+		m[item.CandidateID] = item.Value
+	}
+	return m
 }
 
 // QueryNodeAssignments 查询节点指派
-func (f *Flow) QueryNodeAssignments(nodeID string) ([]*model.NodeAssignment, error) {
-	return f.FlowModel.QueryNodeAssignments(nodeID)
+func (f *Flow) QueryNodeAssignments(ctx context.Context, nodeID string) ([]*model.NodeAssignment, error) {
+	return f.FlowModel.QueryNodeAssignments(ctx, nodeID)
 }
 
-// CreateNodeInstance 创建节点实例
-func (f *Flow) CreateNodeInstance(flowInstanceID, nodeID string, inputData []byte, candidates []string) (string, error) {
+// CreateNodeInstance 创建节点实例(candidates由ApplyDelegationRules生成)
+func (f *Flow) CreateNodeInstance(ctx context.Context, flowInstanceID, nodeID string, inputData []byte, candidates []*model.NodeCandidate) (*model.NodeInstance, error) {
 	nodeInstance := &model.NodeInstance{
 		RecordID:       util.UUID(),
+		TenantID:       tenantOf(ctx),
 		FlowInstanceID: flowInstanceID,
 		NodeID:         nodeID,
 		InputData:      string(inputData),
 		Status:         1,
+		Metadata:       metadata.Encode(ctx),
 		Created:        time.Now().Unix(),
 	}
 
-	var nodeCandidates []*model.NodeCandidate
 	for _, c := range candidates {
-		nodeCandidates = append(nodeCandidates, &model.NodeCandidate{
-			RecordID:       util.UUID(),
-			NodeInstanceID: nodeInstance.RecordID,
-			CandidateID:    c,
-			Created:        nodeInstance.Created,
-		})
+		c.RecordID = util.UUID()
+		c.NodeInstanceID = nodeInstance.RecordID
+		c.Created = nodeInstance.Created
 	}
 
-	err := f.FlowModel.CreateNodeInstance(nodeInstance, nodeCandidates)
+	err := f.FlowModel.CreateNodeInstance(ctx, nodeInstance, candidates)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return nodeInstance.RecordID, nil
+	return nodeInstance, nil
 }
 
 // GetNodeProperty 获取节点属性
-func (f *Flow) GetNodeProperty(nodeID string) (map[string]string, error) {
-	items, err := f.FlowModel.QueryNodeProperty(nodeID)
+func (f *Flow) GetNodeProperty(ctx context.Context, nodeID string) (map[string]string, error) {
+	items, err := f.FlowModel.QueryNodeProperty(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]string)
+	for _, item := range items {
+		data[item.Name] = item.Value
+	}
+	return data, nil
+}
+
+// GetFlowProperty 获取流程属性
+func (f *Flow) GetFlowProperty(ctx context.Context, flowID string) (map[string]string, error) {
+	items, err := f.FlowModel.QueryFlowProperty(ctx, flowID)
 	if err != nil {
 		return nil, err
 	}
@@ -209,31 +660,542 @@ func (f *Flow) GetNodeProperty(nodeID string) (map[string]string, error) {
 	return data, nil
 }
 
+// CreateDeadLetter 创建投递失败的通知
+func (f *Flow) CreateDeadLetter(ctx context.Context, item *model.DeadLetter) error {
+	item.ID = 0
+	item.RecordID = util.UUID()
+	return f.FlowModel.CreateDeadLetter(ctx, item)
+}
+
 // CreateNodeTiming 创建定时节点
-func (f *Flow) CreateNodeTiming(item *model.NodeTiming) error {
+func (f *Flow) CreateNodeTiming(ctx context.Context, item *model.NodeTiming) error {
 	item.ID = 0
-	return f.FlowModel.CreateNodeTiming(item)
+	return f.FlowModel.CreateNodeTiming(ctx, item)
 }
 
 // QueryTodo 查询用户的待办节点实例数据
-func (f *Flow) QueryTodo(typeCode string, flowCode string, userID string, limit int) ([]*model.FlowTodoResult, error) {
-	return f.FlowModel.QueryTodo(typeCode, flowCode, userID, limit)
+func (f *Flow) QueryTodo(ctx context.Context, typeCode string, flowCode string, userID string, limit int) ([]*model.FlowTodoResult, error) {
+	return f.FlowModel.QueryTodo(ctx, tenantOf(ctx), typeCode, flowCode, userID, limit)
 }
 
 // QueryDoneIDs 查询已办理的流程实例ID列表
-func (f *Flow) QueryDoneIDs(flowCode, userID string) ([]string, error) {
-	return f.FlowModel.QueryDoneIDs(flowCode, userID)
+func (f *Flow) QueryDoneIDs(ctx context.Context, flowCode, userID string) ([]string, error) {
+	return f.FlowModel.QueryDoneIDs(ctx, tenantOf(ctx), flowCode, userID)
+}
+
+// StopFlowInstance 停止流程实例，并关闭所有未完成的节点实例
+func (f *Flow) StopFlowInstance(ctx context.Context, flowInstanceID string) error {
+	history := newFlowInstanceHistory(ctx, flowInstanceID, model.HistoryActionStop)
+	ok, err := f.FlowModel.StopFlowInstance(ctx, flowInstanceID, history)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.New("流程实例已结束")
+	}
+	return nil
+}
+
+// SuspendFlowInstance 暂停流程实例
+func (f *Flow) SuspendFlowInstance(ctx context.Context, flowInstanceID string) error {
+	history := newFlowInstanceHistory(ctx, flowInstanceID, model.HistoryActionSuspend)
+	ok, err := f.FlowModel.ChangeFlowInstanceStatus(ctx, flowInstanceID, 1, 2, history)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.New("只有进行中的流程实例可以暂停")
+	}
+	return nil
+}
+
+// ResumeFlowInstance 恢复已暂停的流程实例
+func (f *Flow) ResumeFlowInstance(ctx context.Context, flowInstanceID string) error {
+	history := newFlowInstanceHistory(ctx, flowInstanceID, model.HistoryActionResume)
+	ok, err := f.FlowModel.ChangeFlowInstanceStatus(ctx, flowInstanceID, 2, 1, history)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.New("只有已暂停的流程实例可以恢复")
+	}
+	return nil
+}
+
+// SetVariables 设置流程实例变量
+// scope 作用域(空字符串表示流程实例级别，节点实例内码表示节点级别)
+func (f *Flow) SetVariables(ctx context.Context, flowInstanceID, scope string, vars map[string]interface{}) error {
+	if len(vars) == 0 {
+		return nil
+	}
+
+	// 只有进行中或暂停的流程实例可以修改变量
+	flowInstance, err := f.GetFlowInstance(ctx, flowInstanceID)
+	if err != nil {
+		return err
+	} else if flowInstance == nil {
+		return errors.New("流程实例不存在")
+	} else if flowInstance.Status != 1 && flowInstance.Status != 2 {
+		return errors.New("流程实例已结束，不能修改变量")
+	}
+
+	now := time.Now().Unix()
+	items := make([]*model.FlowVariable, 0, len(vars))
+	for name, value := range vars {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("无效的变量值[%s]: %s", name, err.Error())
+		}
+
+		items = append(items, &model.FlowVariable{
+			RecordID:       util.UUID(),
+			FlowInstanceID: flowInstanceID,
+			Scope:          scope,
+			Name:           name,
+			TypeCode:       variableType(value),
+			Value:          string(data),
+			Created:        now,
+			Updated:        now,
+		})
+	}
+	return f.FlowModel.SaveFlowVariables(ctx, items)
+}
+
+// GetVariables 获取流程实例变量
+// scopes 作用域列表，后面作用域的变量覆盖前面作用域的同名变量
+func (f *Flow) GetVariables(ctx context.Context, flowInstanceID string, scopes ...string) (map[string]interface{}, error) {
+	if len(scopes) == 0 {
+		scopes = []string{""}
+	}
+
+	items, err := f.FlowModel.QueryFlowVariables(ctx, flowInstanceID, scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]interface{})
+	for _, scope := range scopes {
+		for _, item := range items {
+			if item.Scope != scope {
+				continue
+			}
+
+			var value interface{}
+			if err := json.Unmarshal([]byte(item.Value), &value); err != nil {
+				return nil, fmt.Errorf("无效的变量值[%s]: %s", item.Name, err.Error())
+			}
+			vars[item.Name] = value
+		}
+	}
+	return vars, nil
+}
+
+// MergeInputVariables 将输入数据(JSON对象)的字段合并到流程实例变量，输入数据不是JSON对象时返回错误
+func (f *Flow) MergeInputVariables(ctx context.Context, flowInstanceID string, inputData []byte) error {
+	if len(inputData) == 0 {
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(inputData, &data); err != nil {
+		return errors.Wrapf(err, "解析输入数据发生错误")
+	}
+
+	// 非JSON对象的输入数据不做合并
+	vars, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return f.SetVariables(ctx, flowInstanceID, "", vars)
+}
+
+// 获取变量类型
+func variableType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return model.VariableTypeNull
+	case string:
+		return model.VariableTypeString
+	case bool:
+		return model.VariableTypeBool
+	case float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		return model.VariableTypeNumber
+	}
+	return model.VariableTypeJSON
+}
+
+// QueryExpiredNodeTimings 查询已到期的节点定时
+func (f *Flow) QueryExpiredNodeTimings(ctx context.Context, limit int) ([]*model.NodeTiming, error) {
+	return f.FlowModel.QueryExpiredNodeTimings(ctx, time.Now().Unix(), limit)
+}
+
+// DoneNodeTiming 完成节点定时
+func (f *Flow) DoneNodeTiming(ctx context.Context, nodeInstanceID string) error {
+	info := map[string]interface{}{
+		"deleted": time.Now().Unix(),
+	}
+	return f.FlowModel.UpdateNodeTiming(ctx, nodeInstanceID, info)
+}
+
+// GetIdempotentResult 获取幂等键对应的处理结果及请求指纹，不存在时返回nil
+func (f *Flow) GetIdempotentResult(ctx context.Context, key, operation string) (*model.HandleResult, string, error) {
+	item, err := f.FlowModel.GetIdempotency(ctx, tenantOf(ctx), key, operation)
+	if err != nil {
+		return nil, "", err
+	} else if item == nil {
+		return nil, "", nil
+	}
+
+	var result model.HandleResult
+	err = json.Unmarshal([]byte(item.Result), &result)
+	if err != nil {
+		return nil, "", fmt.Errorf("无效的幂等记录[%s]: %s", key, err.Error())
+	}
+	return &result, item.Fingerprint, nil
+}
+
+// SaveIdempotentResult 保存幂等键对应的处理结果及请求指纹
+func (f *Flow) SaveIdempotentResult(ctx context.Context, key, operation, fingerprint string, result *model.HandleResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("无效的处理结果: %s", err.Error())
+	}
+
+	item := &model.Idempotency{
+		RecordID:    util.UUID(),
+		TenantID:    tenantOf(ctx),
+		Key:         key,
+		Operation:   operation,
+		Fingerprint: fingerprint,
+		Result:      string(data),
+		Created:     time.Now().Unix(),
+	}
+	return f.FlowModel.CreateIdempotency(ctx, item)
+}
+
+// DefaultJobRetries 异步作业默认的重试次数
+const DefaultJobRetries = 3
+
+// CountExpiredNodeTimings 查询已到期未处理的节点定时数量
+func (f *Flow) CountExpiredNodeTimings(ctx context.Context) (int64, error) {
+	return f.FlowModel.CountExpiredNodeTimings(ctx, time.Now().Unix())
+}
+
+// QueryNodeTodoCounts 查询各节点的待办数量
+func (f *Flow) QueryNodeTodoCounts(ctx context.Context) ([]*model.NodeTodoCount, error) {
+	return f.FlowModel.QueryNodeTodoCounts(ctx)
 }
 
-// StopFlowInstance 停止流程实例
-func (f *Flow) StopFlowInstance(flowInstanceID string) error {
+// CreateJob 创建异步作业
+func (f *Flow) CreateJob(ctx context.Context, item *model.Job) error {
+	now := time.Now().Unix()
+	item.ID = 0
+	item.RecordID = util.UUID()
+	item.Status = 1
+	item.Created = now
+	if item.DueAt == 0 {
+		item.DueAt = now
+	}
+	if item.Retries == 0 {
+		item.Retries = DefaultJobRetries
+	}
+	return f.FlowModel.CreateJob(ctx, item)
+}
+
+// AcquireJobs 锁定并获取到期的异步作业
+// owner 执行器标识
+// lockDuration 锁定时长，超过锁定时长未完成的作业可以被其他执行器重新获取
+func (f *Flow) AcquireJobs(ctx context.Context, owner string, lockDuration time.Duration, limit int) ([]*model.Job, error) {
+	now := time.Now()
+	return f.FlowModel.AcquireJobs(ctx, owner, now.Unix(), now.Add(lockDuration).Unix(), limit)
+}
+
+// DoneJob 完成异步作业
+func (f *Flow) DoneJob(ctx context.Context, job *model.Job) error {
 	info := map[string]interface{}{
-		"status": 9,
+		"attempts": job.Attempts + 1,
+		"status":   2,
+		"updated":  time.Now().Unix(),
+	}
+	ok, err := f.FlowModel.UpdateJob(ctx, job.RecordID, job.LockOwner, info)
+	if err != nil {
+		return err
+	} else if !ok {
+		return errors.New("异步作业的锁定已失效")
+	}
+	return nil
+}
+
+// FailJob 记录异步作业执行失败，还有剩余重试次数时在retryAfter后重新执行，否则作业执行失败并创建流程事件
+// 返回作业是否已执行失败(不再重试)
+func (f *Flow) FailJob(ctx context.Context, job *model.Job, cause error, retryAfter time.Duration) (bool, error) {
+	now := time.Now()
+	info := map[string]interface{}{
+		"retries":         job.Retries - 1,
+		"attempts":        job.Attempts + 1,
+		"error_message":   cause.Error(),
+		"lock_owner":      "",
+		"lock_expired_at": 0,
+		"updated":         now.Unix(),
+	}
+
+	failed := job.Retries <= 1
+	if failed {
+		info["status"] = 3
+	} else {
+		info["due_at"] = now.Add(retryAfter).Unix()
+	}
+
+	err := f.ExecTrans(ctx, func(ctx context.Context) error {
+		ok, err := f.FlowModel.UpdateJob(ctx, job.RecordID, job.LockOwner, info)
+		if err != nil || !ok || !failed {
+			return err
+		}
+
+		return f.FlowModel.CreateIncident(ctx, &model.Incident{
+			RecordID:       util.UUID(),
+			FlowInstanceID: job.FlowInstanceID,
+			NodeInstanceID: job.NodeInstanceID,
+			JobID:          job.RecordID,
+			TypeCode:       model.IncidentTypeFailedJob,
+			ErrorMessage:   cause.Error(),
+			Stack:          fmt.Sprintf("%+v", cause),
+			RetryCount:     job.Attempts + 1,
+			Status:         1,
+			Created:        now.Unix(),
+		})
+	})
+	if err != nil {
+		return false, err
 	}
-	return f.FlowModel.UpdateFlowInstance(flowInstanceID, info)
+	return failed, nil
+}
+
+// QueryIncidents 查询未处理的流程事件，flowInstanceID为空时查询所有流程实例
+func (f *Flow) QueryIncidents(ctx context.Context, flowInstanceID string) ([]*model.Incident, error) {
+	return f.FlowModel.QueryIncidents(ctx, tenantOf(ctx), flowInstanceID)
+}
+
+// GetIncident 获取流程事件
+func (f *Flow) GetIncident(ctx context.Context, recordID string) (*model.Incident, error) {
+	return f.FlowModel.GetIncident(ctx, recordID)
+}
+
+// 获取未处理的流程事件并关闭
+func (f *Flow) closeIncident(ctx context.Context, incidentID, userID string, status int64, action string) (*model.Incident, error) {
+	incident, err := f.FlowModel.GetIncident(ctx, incidentID)
+	if err != nil {
+		return nil, err
+	} else if incident == nil || incident.Status != 1 {
+		return nil, errors.New("无效的流程事件")
+	}
+
+	flowInstance, err := f.GetFlowInstance(ctx, incident.FlowInstanceID)
+	if err != nil {
+		return nil, err
+	} else if flowInstance == nil {
+		return nil, errors.New("无效的流程事件")
+	}
+
+	history := &model.InstanceHistory{
+		RecordID:       util.UUID(),
+		FlowInstanceID: incident.FlowInstanceID,
+		NodeInstanceID: incident.NodeInstanceID,
+		Action:         action,
+		Operator:       userID,
+		Target:         incident.RecordID,
+		Metadata:       metadata.Encode(ctx),
+		Created:        time.Now().Unix(),
+	}
+	ok, err := f.FlowModel.CloseIncident(ctx, incident, status, history)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errors.New("流程事件已被处理")
+	}
+	return incident, nil
+}
+
+// RetryIncident 重试流程事件，失败的异步作业以retries次重试次数重新执行
+func (f *Flow) RetryIncident(ctx context.Context, incidentID, userID string, retries int64) error {
+	if retries <= 0 {
+		retries = DefaultJobRetries
+	}
+
+	return f.ExecTrans(ctx, func(ctx context.Context) error {
+		incident, err := f.closeIncident(ctx, incidentID, userID, 2, model.HistoryActionRetryIncident)
+		if err != nil {
+			return err
+		}
+
+		ok, err := f.FlowModel.RetryJob(ctx, incident.JobID, retries, time.Now().Unix())
+		if err != nil {
+			return err
+		} else if !ok {
+			return errors.New("无效的异步作业")
+		}
+		return nil
+	})
+}
+
+// ResolveIncident 人工解决流程事件，失败的异步作业不再执行
+// 等待该作业的节点实例恢复为待处理
+func (f *Flow) ResolveIncident(ctx context.Context, incidentID, userID string) error {
+	return f.ExecTrans(ctx, func(ctx context.Context) error {
+		incident, err := f.closeIncident(ctx, incidentID, userID, 3, model.HistoryActionResolveIncident)
+		if err != nil {
+			return err
+		}
+
+		err = f.FlowModel.DeleteJob(ctx, incident.JobID)
+		if err != nil {
+			return err
+		}
+
+		nodeInstance, err := f.FlowModel.GetNodeInstance(ctx, incident.NodeInstanceID)
+		if err != nil || nodeInstance == nil || nodeInstance.Status != 5 {
+			return err
+		}
+		return f.UpdateNodeInstanceStatus(ctx, nodeInstance, 1)
+	})
+}
+
+// CreateOutbox 创建发件箱事件
+func (f *Flow) CreateOutbox(ctx context.Context, eventType, flowInstanceID string, payload []byte) error {
+	now := time.Now().Unix()
+	item := &model.Outbox{
+		RecordID:       util.UUID(),
+		EventType:      eventType,
+		FlowInstanceID: flowInstanceID,
+		Payload:        string(payload),
+		NextAttemptAt:  now,
+		Status:         1,
+		Created:        now,
+	}
+	return f.FlowModel.CreateOutbox(ctx, item)
+}
+
+// AcquireOutboxes 锁定并获取待投递的发件箱事件
+// owner 中继标识
+// lockDuration 锁定时长，超过锁定时长未投递的事件可以被其他中继重新获取
+func (f *Flow) AcquireOutboxes(ctx context.Context, owner string, lockDuration time.Duration, limit int) ([]*model.Outbox, error) {
+	now := time.Now()
+	return f.FlowModel.AcquireOutboxes(ctx, owner, now.Unix(), now.Add(lockDuration).Unix(), limit)
+}
+
+// DeliverOutbox 标记发件箱事件已投递
+func (f *Flow) DeliverOutbox(ctx context.Context, item *model.Outbox) error {
+	now := time.Now().Unix()
+	info := map[string]interface{}{
+		"attempts":     item.Attempts + 1,
+		"status":       2,
+		"delivered_at": now,
+		"updated":      now,
+	}
+	_, err := f.FlowModel.UpdateOutbox(ctx, item.RecordID, item.LockOwner, info)
+	return err
+}
+
+// FailOutbox 记录发件箱事件投递失败，在retryAfter后重新投递
+func (f *Flow) FailOutbox(ctx context.Context, item *model.Outbox, cause error, retryAfter time.Duration) error {
+	now := time.Now()
+	info := map[string]interface{}{
+		"attempts":        item.Attempts + 1,
+		"next_attempt_at": now.Add(retryAfter).Unix(),
+		"error_message":   cause.Error(),
+		"lock_owner":      "",
+		"lock_expired_at": 0,
+		"updated":         now.Unix(),
+	}
+	_, err := f.FlowModel.UpdateOutbox(ctx, item.RecordID, item.LockOwner, info)
+	return err
 }
 
 // DeleteFlow 删除流程
-func (f *Flow) DeleteFlow(flowID string) error {
-	return f.FlowModel.DeleteFlow(flowID)
-}
\ No newline at end of file
+func (f *Flow) DeleteFlow(ctx context.Context, flowID string) error {
+	return f.FlowModel.DeleteFlow(ctx, flowID)
+}
+
+// CreateDelegationRule 创建委托规则
+func (f *Flow) CreateDelegationRule(ctx context.Context, item *model.DelegationRule) error {
+	if item.Delegator == "" || item.Delegate == "" {
+		return errors.New("委托人和受托人不能为空")
+	} else if item.Delegator == item.Delegate {
+		return errors.New("委托人和受托人不能相同")
+	} else if item.EndTime <= item.StartTime {
+		return errors.New("委托规则的结束时间必须大于开始时间")
+	}
+
+	item.RecordID = util.UUID()
+	item.TenantID = tenantOf(ctx)
+	item.Created = time.Now().Unix()
+	item.Updated = item.Created
+	item.Deleted = 0
+	return f.FlowModel.CreateDelegationRule(ctx, item)
+}
+
+// GetDelegationRule 获取委托规则(不属于当前租户的规则返回nil)
+func (f *Flow) GetDelegationRule(ctx context.Context, recordID string) (*model.DelegationRule, error) {
+	item, err := f.FlowModel.GetDelegationRule(ctx, recordID)
+	if err != nil || item == nil || item.TenantID != tenantOf(ctx) {
+		return nil, err
+	}
+	return item, nil
+}
+
+// DeleteDelegationRule 删除委托规则
+func (f *Flow) DeleteDelegationRule(ctx context.Context, recordID string) error {
+	return f.FlowModel.DeleteDelegationRule(ctx, recordID)
+}
+
+// QueryDelegationRules 查询委托人的委托规则
+func (f *Flow) QueryDelegationRules(ctx context.Context, delegator string) ([]*model.DelegationRule, error) {
+	return f.FlowModel.QueryDelegationRules(ctx, tenantOf(ctx), delegator)
+}
+
+// ApplyDelegationRules 按当前生效的委托规则将候选人转交给受托人，返回节点候选人(OriginalID记录委托人)
+// 指定流程的规则优先于适用所有流程的规则，受托人也委托了他人时按委托链转交，出现循环时保留原候选人
+func (f *Flow) ApplyDelegationRules(ctx context.Context, flowCode string, candidates []string) ([]*model.NodeCandidate, error) {
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	rules, err := f.FlowModel.QueryActiveDelegationRules(ctx, tenantOf(ctx), flowCode, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	delegates := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		if _, ok := delegates[rule.Delegator]; !ok {
+			delegates[rule.Delegator] = rule.Delegate
+		}
+	}
+
+	var result []*model.NodeCandidate
+	exists := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		target := c
+		visited := map[string]bool{c: true}
+		for {
+			next, ok := delegates[target]
+			if !ok {
+				break
+			} else if visited[next] {
+				target = c
+				break
+			}
+			visited[next] = true
+			target = next
+		}
+
+		if exists[target] {
+			continue
+		}
+		exists[target] = true
+
+		item := &model.NodeCandidate{CandidateID: target}
+		if target != c {
+			item.OriginalID = c
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
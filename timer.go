@@ -0,0 +1,88 @@
+package kitten
+
+import (
+	"context"
+	"time"
+
+	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/logger"
+)
+
+// 每次处理的节点定时数量
+const timingBatchSize = 100
+
+// RunTimer 定时处理已到期的节点定时，直到ctx结束
+// interval 检查间隔
+func (e *Engine) RunTimer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.HandleExpiredTimings(ctx); err != nil {
+				e.logError(ctx, "处理节点定时发生错误", err)
+			}
+		}
+	}
+}
+
+// HandleExpiredTimings 处理已到期的节点定时
+// 只处理进行中的流程实例，暂停的流程实例在恢复后继续处理
+func (e *Engine) HandleExpiredTimings(ctx context.Context) error {
+	timings, err := e.flowSvc.QueryExpiredNodeTimings(ctx, timingBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, timing := range timings {
+		// 以定时设定的处理人及输入数据流转节点，流转与定时完成在同一事务中执行
+		tctx := restoreMetadataContext(ctx, timing.Metadata, timing.Flag)
+		err := e.execTrans(tctx, func(ctx context.Context) error {
+			err := e.fireTimer(ctx, timing)
+			if err != nil {
+				return err
+			}
+
+			_, err = e.nextFlowHandle(ctx, timing.NodeInstanceID, timing.Processor, []byte(timing.Input))
+			if err != nil {
+				return err
+			}
+			return e.flowSvc.DoneNodeTiming(ctx, timing.NodeInstanceID)
+		})
+		if err != nil {
+			e.logError(ctx, "处理节点定时发生错误", err, logger.F(logger.NodeInstanceIDKey, timing.NodeInstanceID))
+		}
+	}
+
+	return nil
+}
+
+// 触发节点定时事件
+func (e *Engine) fireTimer(ctx context.Context, timing *model.NodeTiming) error {
+	nodeInstance, err := e.flowSvc.GetNodeInstance(ctx, timing.NodeInstanceID)
+	if err != nil {
+		return err
+	} else if nodeInstance == nil {
+		return ErrNotFound
+	}
+
+	flowInstance, err := e.flowSvc.GetFlowInstance(ctx, nodeInstance.FlowInstanceID)
+	if err != nil {
+		return err
+	}
+
+	err = e.flowSvc.AddTimerHistory(ctx, nodeInstance, timing.Processor)
+	if err != nil {
+		return err
+	}
+
+	return e.fire(ctx, &Event{
+		Type:         EventTimerFired,
+		FlowInstance: flowInstance,
+		NodeInstance: nodeInstance,
+		Operator:     timing.Processor,
+	})
+}
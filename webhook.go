@@ -0,0 +1,103 @@
+package kitten
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/chapin666/kitten/model"
+	"github.com/chapin666/kitten/pkg/metadata"
+	"github.com/chapin666/kitten/pkg/publisher"
+	"github.com/chapin666/kitten/pkg/webhook"
+)
+
+// 通知配置的属性名称(流程属性或节点属性，节点属性优先)
+const (
+	WebhookURLProperty    = "webhook_url"    // 通知地址
+	WebhookEventsProperty = "webhook_events" // 通知的事件类型(可以为任意事件类型)，多个以逗号分隔，默认为task_assigned,flow_ended
+)
+
+// NewWebhookPublisher 创建webhook通知的发布者，配合EnableOutbox及NewOutboxRelay使用
+// 按流程或节点属性配置的地址及事件类型(默认为任务分配与流程结束)发送签名的通知，通知ID为发件箱事件ID，重复投递时保持不变
+// 超过重试次数的通知保存到死信表，不再由中继重新投递
+func (e *Engine) NewWebhookPublisher(options ...webhook.Option) publisher.Publisher {
+	opts := append([]webhook.Option{webhook.SetDeadLetterStore(e)}, options...)
+	notifier := webhook.New(opts...)
+
+	return publisher.PublishFunc(func(ctx context.Context, msg *publisher.Message) error {
+		var event Event
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			return err
+		}
+		if event.Metadata != nil {
+			ctx = metadata.NewContext(ctx, event.Metadata)
+		}
+
+		err := e.notifyWebhook(ctx, notifier, msg.ID, &event, msg.Payload)
+		if errors.Is(err, webhook.ErrDeadLetter) {
+			return nil
+		}
+		return err
+	})
+}
+
+// 发送事件通知
+func (e *Engine) notifyWebhook(ctx context.Context, notifier *webhook.Notifier, deliveryID string, event *Event, payload []byte) error {
+	if event.FlowInstance == nil {
+		return nil
+	}
+
+	props, err := e.flowSvc.GetFlowProperty(ctx, event.FlowInstance.FlowID)
+	if err != nil {
+		return err
+	}
+	var nodeID string
+	if event.Node != nil {
+		nodeID = event.Node.RecordID
+	} else if event.NodeInstance != nil {
+		nodeID = event.NodeInstance.NodeID
+	}
+	if nodeID != "" {
+		nodeProps, err := e.flowSvc.GetNodeProperty(ctx, nodeID)
+		if err != nil {
+			return err
+		}
+		for k, v := range nodeProps {
+			props[k] = v
+		}
+	}
+
+	url := props[WebhookURLProperty]
+	if url == "" || !webhookEventEnabled(props[WebhookEventsProperty], event.Type) {
+		return nil
+	}
+
+	return notifier.Notify(ctx, url, string(event.Type), deliveryID, payload)
+}
+
+func webhookEventEnabled(events string, t EventType) bool {
+	if events == "" {
+		return t == EventTaskAssigned || t == EventFlowEnded
+	}
+
+	for _, s := range strings.Split(events, ",") {
+		if EventType(strings.TrimSpace(s)) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveDeadLetter 保存投递失败的通知
+func (e *Engine) SaveDeadLetter(ctx context.Context, item *webhook.DeadLetter) error {
+	return e.flowSvc.CreateDeadLetter(ctx, &model.DeadLetter{
+		URL:          item.URL,
+		EventType:    item.Event,
+		DeliveryID:   item.DeliveryID,
+		Payload:      string(item.Payload),
+		Attempts:     int64(item.Attempts),
+		ErrorMessage: item.ErrorMessage,
+		Created:      item.Created,
+	})
+}